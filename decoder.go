@@ -0,0 +1,444 @@
+package bertlv
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// TokenKind identifies the kind of a Token returned by Decoder.Token.
+type TokenKind int
+
+const (
+	// TokenPrimitive is a complete primitive TLV with its value.
+	TokenPrimitive TokenKind = iota
+	// TokenBegin marks the start of a constructed TLV. Its children follow
+	// as separate tokens until the matching TokenEnd.
+	TokenBegin
+	// TokenEnd marks the end of the most recently opened constructed TLV.
+	TokenEnd
+)
+
+func (k TokenKind) String() string {
+	switch k {
+	case TokenPrimitive:
+		return "primitive"
+	case TokenBegin:
+		return "begin"
+	case TokenEnd:
+		return "end"
+	default:
+		return fmt.Sprintf("TokenKind(%d)", int(k))
+	}
+}
+
+// Token is a single event produced by Decoder.Token.
+type Token struct {
+	Kind TokenKind
+	// Tag is the hex encoded tag. For TokenEnd it is the tag of the
+	// constructed TLV being closed.
+	Tag string
+	// Value holds the value of a primitive TLV.
+	Value []byte
+	// Length is the length of the value (for TokenBegin, the length of
+	// the encoded children). It is zero for indefinite length TLVs.
+	Length int
+	// Indefinite reports whether a TokenBegin uses the indefinite length
+	// form.
+	Indefinite bool
+}
+
+// frame tracks an open constructed TLV while streaming.
+type frame struct {
+	tag string
+	// end is the offset where the value ends, or indefiniteLength when
+	// the value is terminated by end-of-contents.
+	end int
+}
+
+// Decoder reads BER-TLV data objects from an input stream. Unlike Decode,
+// it never holds more than one primitive value in memory when used through
+// Token, so it can be used to process inputs of arbitrary size.
+type Decoder struct {
+	r        *bufio.Reader
+	opts     DecodeOptions
+	offset   int
+	elements int
+	stack    []frame
+	buf      []byte
+	err      error
+}
+
+// NewDecoder returns a new decoder that reads from r.
+func NewDecoder(r io.Reader) *Decoder {
+	return NewDecoderWithOptions(r, DecodeOptions{})
+}
+
+// NewDecoderWithOptions returns a new decoder that reads from r using the
+// given options. KeepRemainder, KeepSource, Lazy, Copy, NestedTags and
+// NestedHeuristic do not apply to streaming.
+func NewDecoderWithOptions(r io.Reader, opts DecodeOptions) *Decoder {
+	return &Decoder{r: bufio.NewReader(r), opts: opts}
+}
+
+// InputOffset returns the number of bytes consumed from the input so far.
+func (d *Decoder) InputOffset() int {
+	return d.offset
+}
+
+// Next reads the next complete TLV at the current nesting level, decoding
+// constructed TLVs with all of their children. It returns io.EOF when there
+// is no more input. Inside a constructed TLV opened with Token, Next returns
+// io.EOF once that TLV is exhausted and decoding continues at the parent
+// level.
+func (d *Decoder) Next() (TLV, error) {
+	tok, err := d.Token()
+	if err != nil {
+		return TLV{}, err
+	}
+
+	switch tok.Kind {
+	case TokenEnd:
+		return TLV{}, io.EOF
+	case TokenBegin:
+		return d.readComposite(tok)
+	default:
+		return TLV{Tag: tok.Tag, Value: tok.Value}, nil
+	}
+}
+
+// readComposite collects the children of the constructed TLV that has just
+// been opened.
+func (d *Decoder) readComposite(begin Token) (TLV, error) {
+	tlv := TLV{Tag: begin.Tag, Indefinite: begin.Indefinite}
+
+	for {
+		child, err := d.Next()
+		if errors.Is(err, io.EOF) {
+			return tlv, nil
+		}
+		if err != nil {
+			return TLV{}, err
+		}
+
+		tlv.TLVs = append(tlv.TLVs, child)
+	}
+}
+
+// Token returns the next token in the input stream. It returns io.EOF when
+// all top level TLVs have been read.
+func (d *Decoder) Token() (Token, error) {
+	if d.err != nil {
+		return Token{}, d.err
+	}
+
+	tok, err := d.token()
+	if err != nil {
+		if errors.Is(err, io.EOF) && len(d.stack) > 0 {
+			err = d.error(d.offset, "", StageValue, errUnexpectedEOF)
+		}
+		d.err = err
+	}
+
+	return tok, err
+}
+
+func (d *Decoder) token() (Token, error) {
+	// the run of padding preceding the token
+	padding, paddingEnd := -1, -1
+	defer func() {
+		d.opts.reportPadding(padding, paddingEnd)
+	}()
+
+	for {
+		limit := d.limit()
+
+		if n := len(d.stack); n > 0 {
+			top := d.stack[n-1]
+
+			if top.end == d.offset {
+				d.stack = d.stack[:n-1]
+
+				return Token{Kind: TokenEnd, Tag: top.tag}, nil
+			}
+
+			if top.end == indefiniteLength {
+				eoc, err := d.readEndOfContents(limit)
+				if err != nil {
+					return Token{}, d.error(d.offset, "", StageValue, err)
+				}
+
+				if eoc {
+					d.stack = d.stack[:n-1]
+
+					return Token{Kind: TokenEnd, Tag: top.tag}, nil
+				}
+
+				if limit == d.offset {
+					return Token{}, d.error(d.offset, "", StageValue, fmt.Errorf("%w: end-of-contents is missing for indefinite length", ErrTruncated))
+				}
+			}
+		}
+
+		start := d.offset
+
+		// '00' or 'FF' bytes may occur between TLV-coded data objects.
+		// Ignore them.
+		if b, err := d.r.Peek(1); err == nil && d.opts.isPadding(b[0]) {
+			if err := d.opts.checkPadding(b[0]); err != nil {
+				return Token{}, d.error(start, "", StageTag, err)
+			}
+
+			if _, err := d.r.Discard(1); err != nil {
+				return Token{}, d.error(start, "", StageTag, err)
+			}
+			d.offset++
+
+			if padding < 0 {
+				padding = start
+			}
+			paddingEnd = d.offset
+
+			continue
+		}
+
+		// read the tag
+		tag, err := d.readTag(limit)
+		if err != nil {
+			if errors.Is(err, io.EOF) && d.offset == start {
+				return Token{}, io.EOF
+			}
+
+			return Token{}, d.error(start, "", StageTag, err)
+		}
+
+		hexTag := tagString(tag)
+		constructed := isConstructed(tag)
+
+		d.elements++
+		if err := d.opts.checkTag(tag, len(d.stack)+1, d.elements); err != nil {
+			return Token{}, d.error(start, hexTag, StageTag, err)
+		}
+
+		// read the length
+		lengthOffset := d.offset
+		length, err := d.readLength(limit)
+		if err != nil {
+			return Token{}, d.error(lengthOffset, hexTag, StageLength, err)
+		}
+
+		if err := d.opts.checkLength(length, d.offset-lengthOffset); err != nil {
+			return Token{}, d.error(lengthOffset, hexTag, StageLength, err)
+		}
+
+		if length == indefiniteLength {
+			if !constructed {
+				return Token{}, d.error(lengthOffset, hexTag, StageLength, fmt.Errorf("%w: indefinite length is not allowed for primitive tag", ErrInvalidLength))
+			}
+
+			if err := d.checkLimit(limit, hexTag, 0); err != nil {
+				return Token{}, err
+			}
+
+			d.stack = append(d.stack, frame{tag: hexTag, end: indefiniteLength})
+
+			return Token{Kind: TokenBegin, Tag: hexTag, Indefinite: true}, nil
+		}
+
+		if err := d.checkLimit(limit, hexTag, length); err != nil {
+			return Token{}, err
+		}
+
+		if constructed && !d.opts.isOpaque(hexTag) {
+			d.stack = append(d.stack, frame{tag: hexTag, end: d.offset + length})
+
+			return Token{Kind: TokenBegin, Tag: hexTag, Length: length}, nil
+		}
+
+		valueOffset := d.offset
+		value, err := d.readValue(length)
+		if err != nil {
+			return Token{}, d.error(valueOffset, hexTag, StageValue, err)
+		}
+
+		return Token{Kind: TokenPrimitive, Tag: hexTag, Value: value, Length: length}, nil
+	}
+}
+
+// limit returns the offset where the innermost definite length constructed
+// TLV ends, or indefiniteLength when there is none.
+func (d *Decoder) limit() int {
+	for i := len(d.stack) - 1; i >= 0; i-- {
+		if d.stack[i].end != indefiniteLength {
+			return d.stack[i].end
+		}
+	}
+
+	return indefiniteLength
+}
+
+// checkLimit ensures that a value of the given length starting at the
+// current offset fits into its parent.
+func (d *Decoder) checkLimit(limit int, tag string, length int) error {
+	if limit != indefiniteLength && d.offset+length > limit {
+		return d.error(d.offset, tag, StageValue, fmt.Errorf("%w: insufficient data for expected length %d", ErrTruncated, length))
+	}
+
+	return nil
+}
+
+// error returns a DecodeError for the data object with the given tag inside
+// the innermost open constructed data object. An empty tag refers to the
+// constructed data object itself.
+func (d *Decoder) error(offset int, tag string, stage DecodeStage, err error) error {
+	path := make([]string, 0, len(d.stack)+1)
+	for _, f := range d.stack {
+		path = append(path, f.tag)
+	}
+	if tag != "" {
+		path = append(path, tag)
+	}
+
+	return newDecodeError(offset, path, stage, err)
+}
+
+// readEndOfContents consumes the end-of-contents marker if it comes next
+// and ends before limit.
+func (d *Decoder) readEndOfContents(limit int) (bool, error) {
+	if limit != indefiniteLength && limit-d.offset < len(endOfContents) {
+		return false, nil
+	}
+
+	next, err := d.r.Peek(len(endOfContents))
+	if err != nil && !errors.Is(err, io.EOF) {
+		return false, err
+	}
+
+	if !isEndOfContents(next) {
+		return false, nil
+	}
+
+	if _, err := d.r.Discard(len(endOfContents)); err != nil {
+		return false, err
+	}
+	d.offset += len(endOfContents)
+
+	return true, nil
+}
+
+func (d *Decoder) readByte() (byte, error) {
+	b, err := d.r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	d.offset++
+
+	return b, nil
+}
+
+// atLimit reports whether the current offset is at the end of the
+// innermost definite length constructed TLV.
+func (d *Decoder) atLimit(limit int) bool {
+	return limit != indefiniteLength && d.offset >= limit
+}
+
+// readTag reads the tag bytes and validates them with decodeTag. Reading
+// stops at limit, so a tag that runs past the end of its parent is
+// rejected as truncated, the same as by Decode.
+func (d *Decoder) readTag(limit int) ([]byte, error) {
+	b, err := d.readByte()
+	if err != nil {
+		return nil, err
+	}
+	d.buf = append(d.buf[:0], b)
+
+	if isMultiByte(d.buf) {
+		for !d.atLimit(limit) {
+			b, err := d.readByte()
+			if err != nil {
+				return nil, unexpectedEOF(err)
+			}
+			d.buf = append(d.buf, b)
+
+			if b&0b1000_0000 != 0b1000_0000 {
+				break
+			}
+
+			// stop reading a tag that can only be rejected
+			if d.opts.MaxTagLength > 0 && len(d.buf) > d.opts.MaxTagLength {
+				return nil, fmt.Errorf("%w: more than %d bytes", ErrTagTooLong, d.opts.MaxTagLength)
+			}
+		}
+	}
+
+	tag, _, err := decodeTag(d.buf)
+	if err != nil {
+		return nil, err
+	}
+
+	return tag, nil
+}
+
+// readLength reads the length bytes and decodes them with decodeLength.
+// Like in readTag, reading stops at limit.
+func (d *Decoder) readLength(limit int) (int, error) {
+	d.buf = d.buf[:0]
+	if d.atLimit(limit) {
+		_, _, err := decodeLength(d.buf)
+		return 0, err
+	}
+
+	b, err := d.readByte()
+	if err != nil {
+		return 0, unexpectedEOF(err)
+	}
+	d.buf = append(d.buf, b)
+
+	if b >= 128 {
+		// only read the long form when decodeLength can accept it
+		if n := int(b & 0b0111_1111); n > 0 && n <= 8 {
+			for i := 0; i < n && !d.atLimit(limit); i++ {
+				b, err := d.readByte()
+				if err != nil {
+					return 0, unexpectedEOF(err)
+				}
+				d.buf = append(d.buf, b)
+			}
+		}
+	}
+
+	length, _, err := decodeLength(d.buf)
+	if err != nil {
+		return 0, err
+	}
+
+	return length, nil
+}
+
+// readValue reads exactly length bytes. The value buffer grows as data
+// arrives, so a bogus length does not cause a large up-front allocation.
+func (d *Decoder) readValue(length int) ([]byte, error) {
+	value, err := io.ReadAll(io.LimitReader(d.r, int64(length)))
+	d.offset += len(value)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(value) < length {
+		return nil, fmt.Errorf("%w: insufficient data for expected length %d: %w", ErrTruncated, length, io.ErrUnexpectedEOF)
+	}
+
+	return value, nil
+}
+
+// errUnexpectedEOF is returned when the stream ends inside a data object.
+var errUnexpectedEOF = fmt.Errorf("%w: %w", ErrTruncated, io.ErrUnexpectedEOF)
+
+func unexpectedEOF(err error) error {
+	if errors.Is(err, io.EOF) {
+		return errUnexpectedEOF
+	}
+
+	return err
+}
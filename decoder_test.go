@@ -0,0 +1,196 @@
+package bertlv_test
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/moov-io/bertlv"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecoderNext(t *testing.T) {
+	data, err := hex.DecodeString("6F2F840E325041592E5359532E4444463031A51DBF0C1A61184F07A0000000041010500A4D617374657263617264870101" + "00" + "9F02060000000012345A0841111111111111116100")
+	require.NoError(t, err)
+
+	expected, err := bertlv.Decode(data)
+	require.NoError(t, err)
+
+	dec := bertlv.NewDecoder(bytes.NewReader(data))
+
+	var decoded []bertlv.TLV
+	for {
+		tlv, err := dec.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		require.NoError(t, err)
+
+		decoded = append(decoded, tlv)
+	}
+
+	require.Equal(t, expected, decoded)
+	require.Equal(t, len(data), dec.InputOffset())
+
+	// io.EOF is sticky
+	_, err = dec.Next()
+	require.ErrorIs(t, err, io.EOF)
+}
+
+func TestDecoderToken(t *testing.T) {
+	data, err := hex.DecodeString("700B" + "5A0441111111" + "A1009F3400" + "8401FF")
+	require.NoError(t, err)
+
+	dec := bertlv.NewDecoder(bytes.NewReader(data))
+
+	var tokens []bertlv.Token
+	for {
+		tok, err := dec.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		require.NoError(t, err)
+
+		tokens = append(tokens, tok)
+	}
+
+	require.Equal(t, []bertlv.Token{
+		{Kind: bertlv.TokenBegin, Tag: "70", Length: 11},
+		{Kind: bertlv.TokenPrimitive, Tag: "5A", Value: []byte{0x41, 0x11, 0x11, 0x11}, Length: 4},
+		{Kind: bertlv.TokenBegin, Tag: "A1", Length: 0},
+		{Kind: bertlv.TokenEnd, Tag: "A1"},
+		{Kind: bertlv.TokenPrimitive, Tag: "9F34", Value: []byte{}, Length: 0},
+		{Kind: bertlv.TokenEnd, Tag: "70"},
+		{Kind: bertlv.TokenPrimitive, Tag: "84", Value: []byte{0xFF}, Length: 1},
+	}, tokens)
+}
+
+func TestDecoderIndefiniteLength(t *testing.T) {
+	data, err := hex.DecodeString("3080" + "020101" + "3180" + "0402AABB" + "0000" + "3000" + "0000" + "7005" + "3080" + "0000" + "00" + "5A0111")
+	require.NoError(t, err)
+
+	expected, err := bertlv.Decode(data)
+	require.NoError(t, err)
+
+	dec := bertlv.NewDecoder(bytes.NewReader(data))
+
+	var decoded []bertlv.TLV
+	for {
+		tlv, err := dec.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		require.NoError(t, err)
+
+		decoded = append(decoded, tlv)
+	}
+
+	require.Equal(t, expected, decoded)
+
+	tok, err := bertlv.NewDecoder(bytes.NewReader(data)).Token()
+	require.NoError(t, err)
+	require.Equal(t, bertlv.Token{Kind: bertlv.TokenBegin, Tag: "30", Indefinite: true}, tok)
+}
+
+func TestDecoderMixTokenAndNext(t *testing.T) {
+	data, err := hex.DecodeString("7006" + "5A01115A0122" + "77035A0133")
+	require.NoError(t, err)
+
+	dec := bertlv.NewDecoder(bytes.NewReader(data))
+
+	tok, err := dec.Token()
+	require.NoError(t, err)
+	require.Equal(t, bertlv.TokenBegin, tok.Kind)
+
+	// read the children of 70 one by one
+	var children []bertlv.TLV
+	for {
+		tlv, err := dec.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		require.NoError(t, err)
+		children = append(children, tlv)
+	}
+	require.Equal(t, []bertlv.TLV{
+		bertlv.NewTag("5A", []byte{0x11}),
+		bertlv.NewTag("5A", []byte{0x22}),
+	}, children)
+
+	// decoding continues at the top level
+	tlv, err := dec.Next()
+	require.NoError(t, err)
+	require.Equal(t, bertlv.NewComposite("77", bertlv.NewTag("5A", []byte{0x33})), tlv)
+
+	_, err = dec.Next()
+	require.ErrorIs(t, err, io.EOF)
+}
+
+func TestDecoderErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{name: "incomplete multi-byte tag", data: "9F"},
+		{name: "missing length", data: "5A"},
+		{name: "incomplete long form length", data: "5A8201"},
+		{name: "truncated value", data: "5A04411111"},
+		{name: "truncated composite", data: "70055A01"},
+		{name: "child exceeds parent", data: "70025A0411111111"},
+		{name: "indefinite length", data: "5A80"},
+		{name: "indefinite length without end-of-contents", data: "30805A0111"},
+		{name: "indefinite length exceeds parent", data: "700430805A0111"},
+		{name: "too many length bytes", data: "5A89"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := hex.DecodeString(tt.data)
+			require.NoError(t, err)
+
+			dec := bertlv.NewDecoder(bytes.NewReader(data))
+
+			var lastErr error
+			for lastErr == nil {
+				_, lastErr = dec.Next()
+			}
+			require.NotErrorIs(t, lastErr, io.EOF)
+
+			// the error is sticky
+			_, err = dec.Token()
+			require.Equal(t, lastErr, err)
+		})
+	}
+}
+
+func TestDecoderHeaderExceedsParent(t *testing.T) {
+	for _, data := range []string{
+		"7001" + "5A0111",
+		"7001" + "9F020111",
+		"7002" + "5A820001",
+		"7003" + "A001" + "9F0201",
+		// end-of-contents past the end of the parent
+		"E003" + "308000" + "005A0101",
+	} {
+		t.Run(data, func(t *testing.T) {
+			data, err := hex.DecodeString(data)
+			require.NoError(t, err)
+
+			_, expected := bertlv.Decode(data)
+			require.Error(t, expected)
+
+			_, err = bertlv.NewDecoder(bytes.NewReader(data)).Next()
+			require.Equal(t, expected, err)
+		})
+	}
+}
+
+func TestDecoderHugeLengthDoesNotAllocate(t *testing.T) {
+	// tag 5A claims a value of 0x7FFFFFFF bytes but the stream ends early
+	dec := bertlv.NewDecoder(bytes.NewReader([]byte{0x5A, 0x84, 0x7F, 0xFF, 0xFF, 0xFF, 0x01}))
+
+	_, err := dec.Next()
+	require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+}
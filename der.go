@@ -0,0 +1,51 @@
+package bertlv
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrNonCanonical is returned when decoding in DER mode finds data that is
+// valid BER but not encoded in its canonical DER form.
+var ErrNonCanonical = errors.New("non-canonical encoding")
+
+// setTag is the universal constructed SET and SET OF tag.
+const setTag = 0x31
+
+// isSet reports whether tag is the universal SET tag.
+func isSet(tag []byte) bool {
+	return len(tag) == 1 && tag[0] == setTag
+}
+
+// checkMinimalTag ensures that tag is encoded in the fewest bytes: the
+// multi-byte form is only used for tag numbers of 31 and above, and the tag
+// number has no leading zero bits.
+func checkMinimalTag(tag []byte) error {
+	if !isMultiByte(tag) {
+		return nil
+	}
+
+	if tag[1] == 0b1000_0000 {
+		return fmt.Errorf("%w: tag %X has leading zero bits", ErrNonCanonical, tag)
+	}
+
+	if len(tag) == 2 && tag[1] < 0b0001_1111 {
+		return fmt.Errorf("%w: tag %X fits into a single byte", ErrNonCanonical, tag)
+	}
+
+	return nil
+}
+
+// checkMinimalLength ensures that a length decoded from read bytes uses the
+// definite form with the fewest bytes.
+func checkMinimalLength(length, read int) error {
+	if length == indefiniteLength {
+		return fmt.Errorf("%w: indefinite length", ErrNonCanonical)
+	}
+
+	if read != encodedLengthSize(length) {
+		return fmt.Errorf("%w: length %d encoded in %d bytes", ErrNonCanonical, length, read)
+	}
+
+	return nil
+}
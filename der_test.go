@@ -0,0 +1,92 @@
+package bertlv_test
+
+import (
+	"encoding/hex"
+	"fmt"
+	"testing"
+
+	"github.com/moov-io/bertlv"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodeDER(t *testing.T) {
+	t.Run("canonical input", func(t *testing.T) {
+		data, err := hex.DecodeString("3009" + "020101" + "3104" + "0402AABB" + "9F1F0101" + "5F2001AA")
+		require.NoError(t, err)
+
+		ber, err := bertlv.Decode(data)
+		require.NoError(t, err)
+
+		der, err := bertlv.DecodeWithOptions(data, bertlv.DecodeOptions{DER: true})
+		require.NoError(t, err)
+		require.Equal(t, ber, der)
+	})
+
+	tests := []struct {
+		name string
+		data string
+	}{
+		{name: "long form for short length", data: "5A8101AA"},
+		{name: "leading zero length byte", data: "5A820001AA"},
+		{name: "indefinite length", data: "308002010100 00"},
+		{name: "multi-byte tag for low tag number", data: "1F0501AA"},
+		{name: "leading zero tag bits", data: "1F801F01AA"},
+		{name: "padding", data: "005A01AA"},
+		{name: "nested non-minimal length", data: "30045A8101AA"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := hex.DecodeString(removeSpaces(tt.data))
+			require.NoError(t, err)
+
+			// valid BER
+			_, err = bertlv.Decode(data)
+			require.NoError(t, err)
+
+			_, err = bertlv.DecodeWithOptions(data, bertlv.DecodeOptions{DER: true})
+			require.ErrorIs(t, err, bertlv.ErrNonCanonical)
+		})
+	}
+}
+
+func TestEncodeDER(t *testing.T) {
+	data := []bertlv.TLV{
+		bertlv.NewComposite("30",
+			bertlv.NewComposite("31",
+				bertlv.NewTag("04", []byte{0xBB, 0xBB}),
+				bertlv.NewTag("02", []byte{0x01}),
+				bertlv.NewTag("04", []byte{0xAA}),
+			),
+			// SEQUENCE contents keep their order
+			bertlv.NewTag("04", []byte{0xBB}),
+			bertlv.NewTag("02", []byte{0x01}),
+		),
+	}
+
+	encoded, err := bertlv.EncodeWithOptions(data, bertlv.EncodeOptions{DER: true})
+	require.NoError(t, err)
+	require.Equal(t, "3012"+"310A"+"020101"+"0401AA"+"0402BBBB"+"0401BB"+"020101", fmt.Sprintf("%X", encoded))
+
+	_, err = bertlv.DecodeWithOptions(encoded, bertlv.DecodeOptions{DER: true})
+	require.NoError(t, err)
+
+	// BER keeps the order of SET elements
+	encoded, err = bertlv.Encode(data)
+	require.NoError(t, err)
+	require.Equal(t, "3012"+"310A"+"0402BBBB"+"020101"+"0401AA"+"0401BB"+"020101", fmt.Sprintf("%X", encoded))
+
+	_, err = bertlv.EncodeWithOptions([]bertlv.TLV{{Tag: "30", Indefinite: true}}, bertlv.EncodeOptions{DER: true})
+	require.Error(t, err)
+}
+
+func removeSpaces(s string) string {
+	out := make([]byte, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		if s[i] != ' ' {
+			out = append(out, s[i])
+		}
+	}
+
+	return string(out)
+}
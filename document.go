@@ -0,0 +1,103 @@
+package bertlv
+
+import (
+	"sync"
+)
+
+// Document decodes BER-TLV data objects into storage that is reused across
+// calls to Reset, so that decoding a steady stream of similar messages
+// allocates close to nothing. Tag strings of known EMV tags are interned.
+//
+// The zero value is ready to use. A Document is not safe for concurrent use.
+type Document struct {
+	table NodeTable
+	slab  []TLV
+	tlvs  []TLV
+	next  int
+}
+
+// Reset decodes data like Decode, replacing the TLVs of the previous call.
+// The TLVs returned by TLVs before are invalid afterwards, and values keep
+// aliasing data.
+func (doc *Document) Reset(data []byte) error {
+	clear(doc.slab)
+	doc.tlvs = nil
+	doc.next = 0
+
+	if err := doc.table.Reset(data); err != nil {
+		return err
+	}
+
+	nodes := doc.table.Nodes
+	if len(nodes) == 0 {
+		return nil
+	}
+
+	if cap(doc.slab) < len(nodes) {
+		doc.slab = make([]TLV, len(nodes))
+	}
+	doc.slab = doc.slab[:len(nodes)]
+
+	doc.tlvs = doc.fill(0)
+
+	return nil
+}
+
+// TLVs returns the decoded TLVs. They are valid until the next call to
+// Reset.
+func (doc *Document) TLVs() []TLV {
+	return doc.tlvs
+}
+
+// fill materializes the node first and its siblings into the next free
+// slots of the slab. Siblings are stored contiguously, so they can be
+// returned as a slice.
+func (doc *Document) fill(first int) []TLV {
+	nodes := doc.table.Nodes
+
+	count := 0
+	for i := first; i >= 0; i = nodes[i].NextSibling {
+		count++
+	}
+
+	start := doc.next
+	tlvs := doc.slab[start : start+count : start+count]
+	doc.next += count
+
+	i := first
+	for k := range tlvs {
+		n := &nodes[i]
+
+		tlvs[k] = TLV{Tag: doc.tag(i), Indefinite: n.Indefinite}
+		if !n.Constructed {
+			tlvs[k].Value = doc.table.Value(i)
+		} else if n.FirstChild >= 0 {
+			tlvs[k].TLVs = doc.fill(n.FirstChild)
+		}
+
+		i = n.NextSibling
+	}
+
+	return tlvs
+}
+
+// tag returns the tag string of node i, interned if it is a known EMV tag.
+func (doc *Document) tag(i int) string {
+	if tag, ok := internedTags()[doc.table.Nodes[i].Tag]; ok {
+		return tag
+	}
+
+	return doc.table.TagString(i)
+}
+
+// internedTags maps the known EMV tags to their strings.
+var internedTags = sync.OnceValue(func() map[Tag]string {
+	tags := make(map[Tag]string, len(emvTags))
+	for s := range emvTags {
+		if tag, err := ParseTag(s); err == nil {
+			tags[tag] = tag.String()
+		}
+	}
+
+	return tags
+})
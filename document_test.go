@@ -0,0 +1,58 @@
+package bertlv_test
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/moov-io/bertlv"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDocumentReset(t *testing.T) {
+	var doc bertlv.Document
+	require.Nil(t, doc.TLVs())
+
+	for _, data := range []string{
+		fciData,
+		"3080" + "020101" + "3180" + "0402AABB" + "0000" + "3000" + "0000" + "5A0111",
+		"DF7F0101" + "7000",
+		"",
+	} {
+		data, err := hex.DecodeString(data)
+		require.NoError(t, err)
+
+		expected, err := bertlv.Decode(data)
+		require.NoError(t, err)
+
+		require.NoError(t, doc.Reset(data))
+		require.Equal(t, expected, doc.TLVs())
+	}
+
+	// errors leave the document empty
+	require.Error(t, doc.Reset([]byte{0x5A, 0x02, 0x11}))
+	require.Nil(t, doc.TLVs())
+}
+
+func TestDocumentResetDoesNotAllocate(t *testing.T) {
+	data, err := hex.DecodeString(fciData)
+	require.NoError(t, err)
+
+	var doc bertlv.Document
+	require.NoError(t, doc.Reset(data))
+
+	allocs := testing.AllocsPerRun(100, func() {
+		_ = doc.Reset(data)
+	})
+	require.Zero(t, allocs)
+}
+
+func BenchmarkDocumentReset(b *testing.B) {
+	data, _ := hex.DecodeString(fciData)
+
+	var doc bertlv.Document
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_ = doc.Reset(data)
+	}
+}
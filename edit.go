@@ -0,0 +1,209 @@
+package bertlv
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// ErrNotConstructed is returned when children would be added to a
+// primitive tag.
+var ErrNotConstructed = errors.New("tag is not constructed/composite")
+
+// The editing functions below address TLVs with dotted paths, resolving
+// them like FindTagByPath. They are
+// copy-on-write: the input tree is left unchanged, and the returned tree
+// only copies the slices along the path, sharing everything else with the
+// input.
+
+// Set sets the value of the TLV at path and removes its children. Missing
+// TLVs on the path are created: intermediate ones as constructed TLVs
+// appended to their parent, which requires their tags to be constructed,
+// and the last one as a TLV with the value.
+func Set(tlvs []TLV, path string, value []byte) ([]TLV, error) {
+	parents, tag, err := splitEditPath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return editPath(tlvs, path, parents, true, func(siblings []TLV) ([]TLV, error) {
+		i := indexPathTag(siblings, tag, true)
+		if i < 0 {
+			return append(slices.Clip(siblings), TLV{Tag: tag, Value: value}), nil
+		}
+
+		siblings = slices.Clone(siblings)
+		siblings[i].Value, siblings[i].TLVs, siblings[i].lazy = value, nil, nil
+
+		return siblings, nil
+	})
+}
+
+// Insert appends tlv to the children of the TLV at path, or to the top
+// level if path is empty. Missing TLVs on the path are created as
+// constructed TLVs, which requires their tags to be constructed.
+func Insert(tlvs []TLV, path string, tlv TLV) ([]TLV, error) {
+	var parents []string
+	if path != "" {
+		var err error
+		if parents, err = normalizePath(path); err != nil {
+			return nil, err
+		}
+	}
+
+	return editPath(tlvs, path, parents, true, func(siblings []TLV) ([]TLV, error) {
+		return append(slices.Clip(siblings), tlv), nil
+	})
+}
+
+// Replace replaces the TLV at path with tlv. It returns ErrNotFound if
+// there is no TLV at path.
+func Replace(tlvs []TLV, path string, tlv TLV) ([]TLV, error) {
+	parents, tag, err := splitEditPath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return editPath(tlvs, path, parents, false, func(siblings []TLV) ([]TLV, error) {
+		i := indexPathTag(siblings, tag, true)
+		if i < 0 {
+			return nil, fmt.Errorf("%w: %s", ErrNotFound, path)
+		}
+
+		siblings = slices.Clone(siblings)
+		siblings[i] = tlv
+
+		return siblings, nil
+	})
+}
+
+// Delete removes the TLV at path. It returns ErrNotFound if there is no
+// TLV at path.
+func Delete(tlvs []TLV, path string) ([]TLV, error) {
+	parents, tag, err := splitEditPath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return editPath(tlvs, path, parents, false, func(siblings []TLV) ([]TLV, error) {
+		i := indexPathTag(siblings, tag, true)
+		if i < 0 {
+			return nil, fmt.Errorf("%w: %s", ErrNotFound, path)
+		}
+
+		return slices.Delete(slices.Clone(siblings), i, i+1), nil
+	})
+}
+
+// editPath replaces the children of the TLV at parents with the result of
+// fn, copying the slices on the way. Missing parents are created when
+// create is set. Lazy parents are decoded.
+func editPath(tlvs []TLV, path string, parents []string, create bool, fn func(siblings []TLV) ([]TLV, error)) ([]TLV, error) {
+	if len(parents) == 0 {
+		return fn(tlvs)
+	}
+
+	tag := parents[0]
+
+	i := indexPathTag(tlvs, tag, false)
+
+	var parent TLV
+	if i >= 0 {
+		parent = tlvs[i]
+	} else if create {
+		parent = TLV{Tag: tag}
+	} else {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, path)
+	}
+
+	if err := checkConstructed(tag); err != nil {
+		return nil, err
+	}
+
+	if len(parent.Value) > 0 && parent.lazy == nil {
+		return nil, fmt.Errorf("tag %s holds an undecoded value", tag)
+	}
+
+	children, err := parent.Children()
+	if err != nil {
+		return nil, fmt.Errorf("decoding children of tag %s: %w", tag, err)
+	}
+
+	if parent.TLVs, err = editPath(children, path, parents[1:], create, fn); err != nil {
+		return nil, err
+	}
+
+	if i < 0 {
+		return append(slices.Clip(tlvs), parent), nil
+	}
+
+	tlvs = slices.Clone(tlvs)
+	tlvs[i] = parent
+
+	return tlvs, nil
+}
+
+// splitEditPath splits path into the normalized tags of the parents and
+// of the addressed TLV.
+func splitEditPath(path string) ([]string, string, error) {
+	tags, err := normalizePath(path)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return tags[:len(tags)-1], tags[len(tags)-1], nil
+}
+
+func normalizePath(path string) ([]string, error) {
+	tags := strings.Split(path, ".")
+	for i := range tags {
+		tag, err := NormalizeTag(tags[i])
+		if err != nil {
+			return nil, fmt.Errorf("path %q: %w", path, err)
+		}
+		tags[i] = tag
+	}
+
+	return tags, nil
+}
+
+// indexPathTag returns the index of the TLV with the normalized tag that a
+// path step refers to, or -1. The last step refers to the first TLV with the
+// tag. The steps before it skip TLVs without children, so that an empty
+// template does not hide a later one with the same tag, and only fall back
+// to the first TLV with the tag when none has children.
+func indexPathTag(tlvs []TLV, tag string, last bool) int {
+	first := -1
+	for i := range tlvs {
+		if !sameTag(tlvs[i].Tag, tag) {
+			continue
+		}
+
+		if last || len(tlvs[i].TLVs) > 0 || (tlvs[i].lazy != nil && len(tlvs[i].Value) > 0) {
+			return i
+		}
+
+		if first < 0 {
+			first = i
+		}
+	}
+
+	return first
+}
+
+// checkConstructed returns ErrNotConstructed if the normalized tag is
+// primitive.
+func checkConstructed(tag string) error {
+	var buf [maxTagBuffer]byte
+	raw, err := appendTag(buf[:0], tag)
+	if err != nil {
+		return err
+	}
+
+	if !isConstructed(raw) {
+		return fmt.Errorf("%w: %s", ErrNotConstructed, tag)
+	}
+
+	return nil
+}
@@ -0,0 +1,210 @@
+package bertlv_test
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/moov-io/bertlv"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSet(t *testing.T) {
+	tlvs := []bertlv.TLV{
+		bertlv.NewComposite("77",
+			bertlv.NewTag("9F02", []byte{0x00, 0x00, 0x00, 0x00, 0x01, 0x00}),
+			bertlv.NewTag("9F27", []byte{0x80}),
+		),
+		bertlv.NewTag("9F36", []byte{0x00, 0x01}),
+	}
+	original := []bertlv.TLV{tlvs[0].Clone(), tlvs[1].Clone()}
+
+	// existing TLV
+	edited, err := bertlv.Set(tlvs, "77.9f02", []byte{0x00, 0x00, 0x00, 0x00, 0x20, 0x00})
+	require.NoError(t, err)
+	require.Equal(t, []bertlv.TLV{
+		bertlv.NewComposite("77",
+			bertlv.NewTag("9F02", []byte{0x00, 0x00, 0x00, 0x00, 0x20, 0x00}),
+			bertlv.NewTag("9F27", []byte{0x80}),
+		),
+		bertlv.NewTag("9F36", []byte{0x00, 0x01}),
+	}, edited)
+
+	// the input is unchanged
+	require.Equal(t, original, tlvs)
+
+	// missing TLVs are appended, creating intermediate constructed TLVs
+	edited, err = bertlv.Set(tlvs, "70.A5.50", []byte("VISA"))
+	require.NoError(t, err)
+	require.Equal(t, append(original,
+		bertlv.NewComposite("70", bertlv.NewComposite("A5", bertlv.NewTag("50", []byte("VISA")))),
+	), edited)
+	require.Equal(t, original, tlvs)
+
+	edited, err = bertlv.Set(tlvs, "77.9F10", []byte{0x01})
+	require.NoError(t, err)
+
+	tlv, found := bertlv.FindTagByPath(edited, "77.9F10")
+	require.True(t, found)
+	require.Equal(t, []byte{0x01}, tlv.Value)
+	require.Len(t, edited[0].TLVs, 3)
+}
+
+func TestSetErrors(t *testing.T) {
+	tlvs := []bertlv.TLV{
+		bertlv.NewComposite("77",
+			bertlv.NewTag("9F02", []byte{0x00, 0x00, 0x00, 0x00, 0x01, 0x00}),
+			bertlv.NewTag("9F27", []byte{0x80}),
+		),
+		bertlv.NewTag("9F36", []byte{0x00, 0x01}),
+	}
+
+	// primitive tags cannot have children
+	_, err := bertlv.Set(tlvs, "9F36.9F02", []byte{0x01})
+	require.ErrorIs(t, err, bertlv.ErrNotConstructed)
+
+	_, err = bertlv.Set(tlvs, "5A.9F02", []byte{0x01})
+	require.ErrorIs(t, err, bertlv.ErrNotConstructed)
+
+	_, err = bertlv.Set(tlvs, "77.XYZ", []byte{0x01})
+	require.ErrorIs(t, err, bertlv.ErrInvalidTag)
+
+	_, err = bertlv.Set(tlvs, "", []byte{0x01})
+	require.Error(t, err)
+}
+
+func TestInsert(t *testing.T) {
+	tlvs := []bertlv.TLV{
+		bertlv.NewComposite("77",
+			bertlv.NewTag("9F02", []byte{0x00, 0x00, 0x00, 0x00, 0x01, 0x00}),
+			bertlv.NewTag("9F27", []byte{0x80}),
+		),
+		bertlv.NewTag("9F36", []byte{0x00, 0x01}),
+	}
+	original := []bertlv.TLV{tlvs[0].Clone(), tlvs[1].Clone()}
+
+	edited, err := bertlv.Insert(tlvs, "77", bertlv.NewTag("9F10", []byte{0x01}))
+	require.NoError(t, err)
+	require.Equal(t, []string{"9F02", "9F27", "9F10"}, tagsOf(edited[0].TLVs))
+	require.Equal(t, original, tlvs)
+
+	edited, err = bertlv.Insert(tlvs, "", bertlv.NewTag("9F37", []byte{0x01}))
+	require.NoError(t, err)
+	require.Equal(t, []string{"77", "9F36", "9F37"}, tagsOf(edited))
+
+	edited, err = bertlv.Insert(tlvs, "70.A5", bertlv.NewTag("50", []byte("VISA")))
+	require.NoError(t, err)
+
+	tlv, found := bertlv.FindTagByPath(edited, "70.A5.50")
+	require.True(t, found)
+	require.Equal(t, []byte("VISA"), tlv.Value)
+
+	_, err = bertlv.Insert(tlvs, "9F36", bertlv.NewTag("50", nil))
+	require.ErrorIs(t, err, bertlv.ErrNotConstructed)
+}
+
+func TestReplace(t *testing.T) {
+	tlvs := []bertlv.TLV{
+		bertlv.NewComposite("77",
+			bertlv.NewTag("9F02", []byte{0x00, 0x00, 0x00, 0x00, 0x01, 0x00}),
+			bertlv.NewTag("9F27", []byte{0x80}),
+		),
+		bertlv.NewTag("9F36", []byte{0x00, 0x01}),
+	}
+	original := []bertlv.TLV{tlvs[0].Clone(), tlvs[1].Clone()}
+
+	edited, err := bertlv.Replace(tlvs, "77.9F27", bertlv.NewComposite("A5"))
+	require.NoError(t, err)
+	require.Equal(t, []string{"9F02", "A5"}, tagsOf(edited[0].TLVs))
+	require.Equal(t, original, tlvs)
+
+	edited, err = bertlv.Replace(tlvs, "9F36", bertlv.NewTag("9F36", []byte{0x00, 0x02}))
+	require.NoError(t, err)
+	require.Equal(t, []byte{0x00, 0x02}, edited[1].Value)
+
+	_, err = bertlv.Replace(tlvs, "77.9F10", bertlv.NewTag("9F10", nil))
+	require.ErrorIs(t, err, bertlv.ErrNotFound)
+
+	_, err = bertlv.Replace(tlvs, "70.9F10", bertlv.NewTag("9F10", nil))
+	require.ErrorIs(t, err, bertlv.ErrNotFound)
+}
+
+func TestDelete(t *testing.T) {
+	tlvs := []bertlv.TLV{
+		bertlv.NewComposite("77",
+			bertlv.NewTag("9F02", []byte{0x00, 0x00, 0x00, 0x00, 0x01, 0x00}),
+			bertlv.NewTag("9F27", []byte{0x80}),
+		),
+		bertlv.NewTag("9F36", []byte{0x00, 0x01}),
+	}
+	original := []bertlv.TLV{tlvs[0].Clone(), tlvs[1].Clone()}
+
+	edited, err := bertlv.Delete(tlvs, "77.9F02")
+	require.NoError(t, err)
+	require.Equal(t, []string{"9F27"}, tagsOf(edited[0].TLVs))
+	require.Equal(t, original, tlvs)
+
+	edited, err = bertlv.Delete(tlvs, "77")
+	require.NoError(t, err)
+	require.Equal(t, []string{"9F36"}, tagsOf(edited))
+
+	_, err = bertlv.Delete(tlvs, "9F10")
+	require.ErrorIs(t, err, bertlv.ErrNotFound)
+}
+
+func TestEditDuplicateTemplates(t *testing.T) {
+	// paths skip the empty template like FindTagByPath
+	tlvs := []bertlv.TLV{
+		bertlv.NewComposite("70"),
+		bertlv.NewComposite("70", bertlv.NewTag("5A", []byte{0x01})),
+	}
+
+	tlv, found := bertlv.FindTagByPath(tlvs, "70.5A")
+	require.True(t, found)
+	require.Equal(t, []byte{0x01}, tlv.Value)
+
+	edited, err := bertlv.Set(tlvs, "70.5A", []byte{0x02})
+	require.NoError(t, err)
+	require.Equal(t, []bertlv.TLV{
+		bertlv.NewComposite("70"),
+		bertlv.NewComposite("70", bertlv.NewTag("5A", []byte{0x02})),
+	}, edited)
+
+	edited, err = bertlv.Delete(tlvs, "70.5A")
+	require.NoError(t, err)
+	require.Empty(t, edited[1].TLVs)
+
+	edited, err = bertlv.Replace(tlvs, "70.5A", bertlv.NewTag("5A", []byte{0x03}))
+	require.NoError(t, err)
+	require.Equal(t, []byte{0x03}, edited[1].TLVs[0].Value)
+
+	// without children the first template is used
+	edited, err = bertlv.Set(tlvs[:1], "70.5A", []byte{0x02})
+	require.NoError(t, err)
+	require.Equal(t, []bertlv.TLV{
+		bertlv.NewComposite("70", bertlv.NewTag("5A", []byte{0x02})),
+	}, edited)
+}
+
+func TestEditLazy(t *testing.T) {
+	data, err := hex.DecodeString("7709" + "9F0206000000000100")
+	require.NoError(t, err)
+
+	tlvs, err := bertlv.DecodeWithOptions(data, bertlv.DecodeOptions{Lazy: true})
+	require.NoError(t, err)
+
+	edited, err := bertlv.Set(tlvs, "77.9F02", []byte{0x00, 0x00, 0x00, 0x00, 0x20, 0x00})
+	require.NoError(t, err)
+
+	encoded, err := bertlv.Encode(edited)
+	require.NoError(t, err)
+	require.Equal(t, "7709"+"9f0206000000002000", hex.EncodeToString(encoded))
+}
+
+func tagsOf(tlvs []bertlv.TLV) []string {
+	var tags []string
+	for _, tlv := range tlvs {
+		tags = append(tags, tlv.Tag)
+	}
+
+	return tags
+}
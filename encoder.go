@@ -0,0 +1,239 @@
+package bertlv
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Encoder writes BER-TLV data objects to an output stream. TLVs are written
+// as soon as they are encoded, and constructed TLVs can be opened with Begin
+// and closed with End, so large structures never have to be held in memory.
+// Wrap the writer in a bufio.Writer when it is expensive to write to.
+type Encoder struct {
+	w      io.Writer
+	offset int
+	stack  []frame
+	buf    []byte
+	err    error
+}
+
+// NewEncoder returns a new encoder that writes to w.
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{w: w}
+}
+
+// Encode writes the TLVs to the stream. Inside a constructed TLV opened with
+// Begin, the TLVs are written as its children.
+func (e *Encoder) Encode(tlvs ...TLV) error {
+	if e.err != nil {
+		return e.err
+	}
+
+	for i := range tlvs {
+		size, err := encodedSize(&tlvs[i], EncodeOptions{})
+		if err != nil {
+			return err
+		}
+
+		if err := e.checkLimit(size); err != nil {
+			return err
+		}
+
+		if err := e.encode(tlvs[i]); err != nil {
+			return e.fail(err)
+		}
+	}
+
+	return nil
+}
+
+// Begin opens a constructed TLV whose children take exactly length bytes
+// once encoded. The header is written immediately; the children are written
+// with Encode or nested Begin/End calls and the TLV is closed with End.
+func (e *Encoder) Begin(tag string, length int) error {
+	if length < 0 {
+		return fmt.Errorf("invalid length %d for tag %s", length, tag)
+	}
+
+	return e.begin(tag, length)
+}
+
+// BeginIndefinite opens a constructed TLV using the indefinite length form,
+// so the length of its children does not have to be known up front. End
+// writes the end-of-contents marker.
+func (e *Encoder) BeginIndefinite(tag string) error {
+	return e.begin(tag, indefiniteLength)
+}
+
+func (e *Encoder) begin(tag string, length int) error {
+	if e.err != nil {
+		return e.err
+	}
+
+	rawTag, err := parseTag(TLV{Tag: tag})
+	if err != nil {
+		return err
+	}
+
+	if !isConstructed(rawTag) {
+		return fmt.Errorf("tag %s is not constructed/composite", tag)
+	}
+
+	size := len(rawTag) + 1
+	if length != indefiniteLength {
+		size = len(rawTag) + encodedLengthSize(length) + length
+	}
+
+	if err := e.checkLimit(size); err != nil {
+		return err
+	}
+
+	if err := e.writeHeader(rawTag, length); err != nil {
+		return e.fail(err)
+	}
+
+	end := indefiniteLength
+	if length != indefiniteLength {
+		end = e.offset + length
+	}
+	e.stack = append(e.stack, frame{tag: tag, end: end})
+
+	return nil
+}
+
+// End closes the constructed TLV opened by the last call to Begin or
+// BeginIndefinite. It returns an error if fewer bytes than announced have
+// been written.
+func (e *Encoder) End() error {
+	if e.err != nil {
+		return e.err
+	}
+
+	if len(e.stack) == 0 {
+		return errors.New("no constructed tag to end")
+	}
+
+	top := e.stack[len(e.stack)-1]
+
+	if top.end == indefiniteLength {
+		e.stack = e.stack[:len(e.stack)-1]
+
+		if err := e.checkLimit(len(endOfContents)); err != nil {
+			e.stack = append(e.stack, top)
+
+			return err
+		}
+
+		if err := e.write(endOfContents); err != nil {
+			return e.fail(err)
+		}
+
+		return nil
+	}
+
+	if top.end != e.offset {
+		return fmt.Errorf("constructed tag %s is missing %d bytes", top.tag, top.end-e.offset)
+	}
+	e.stack = e.stack[:len(e.stack)-1]
+
+	return nil
+}
+
+// checkLimit ensures that n more bytes fit into the open definite length
+// constructed TLVs.
+func (e *Encoder) checkLimit(n int) error {
+	for i := len(e.stack) - 1; i >= 0; i-- {
+		top := e.stack[i]
+		if top.end == indefiniteLength {
+			continue
+		}
+
+		if remaining := top.end - e.offset; n > remaining {
+			return fmt.Errorf("encoding %d bytes exceeds remaining length %d of constructed tag %s", n, remaining, top.tag)
+		}
+
+		break
+	}
+
+	return nil
+}
+
+// fail records a write error. Once the output is partially written the
+// stream is corrupt, so all subsequent calls return the same error.
+func (e *Encoder) fail(err error) error {
+	e.err = err
+
+	return err
+}
+
+func (e *Encoder) encode(tlv TLV) error {
+	if tlv.Raw {
+		if _, err := rawLength(&tlv, EncodeOptions{}); err != nil {
+			return err
+		}
+
+		return e.write(tlv.Value)
+	}
+
+	tag, err := parseTag(tlv)
+	if err != nil {
+		return err
+	}
+
+	if (len(tlv.TLVs) == 0 || !isConstructed(tag)) && !tlv.Indefinite {
+		if err := e.writeHeader(tag, len(tlv.Value)); err != nil {
+			return err
+		}
+
+		return e.write(tlv.Value)
+	}
+
+	length := indefiniteLength
+	if !tlv.Indefinite {
+		length, err = encodedLen(tlv.TLVs, EncodeOptions{})
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := e.writeHeader(tag, length); err != nil {
+		return err
+	}
+
+	if len(tlv.TLVs) == 0 {
+		if err := e.write(tlv.Value); err != nil {
+			return err
+		}
+	}
+
+	for i := range tlv.TLVs {
+		if err := e.encode(tlv.TLVs[i]); err != nil {
+			return err
+		}
+	}
+
+	if tlv.Indefinite {
+		return e.write(endOfContents)
+	}
+
+	return nil
+}
+
+func (e *Encoder) writeHeader(tag []byte, length int) error {
+	e.buf = append(e.buf[:0], tag...)
+	if length == indefiniteLength {
+		e.buf = append(e.buf, indefiniteLengthByte)
+	} else {
+		e.buf = appendLength(e.buf, length)
+	}
+
+	return e.write(e.buf)
+}
+
+func (e *Encoder) write(p []byte) error {
+	n, err := e.w.Write(p)
+	e.offset += n
+
+	return err
+}
@@ -0,0 +1,142 @@
+package bertlv_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/moov-io/bertlv"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncoderEncode(t *testing.T) {
+	data := []bertlv.TLV{
+		bertlv.NewComposite("6F", // File Control Information (FCI) Template
+			bertlv.NewTag("84", []byte{0x32, 0x50, 0x41, 0x59, 0x2E, 0x53, 0x59, 0x53, 0x2E, 0x44, 0x44, 0x46, 0x30, 0x31}),
+			bertlv.NewComposite("A5", // FCI Proprietary Template
+				bertlv.NewComposite("BF0C", // FCI Issuer Discretionary Data
+					bertlv.NewComposite("61", // Application Template
+						bertlv.NewTag("4F", []byte{0xA0, 0x00, 0x00, 0x00, 0x04, 0x10, 0x10}),
+						bertlv.NewTag("50", []byte{0x4D, 0x61, 0x73, 0x74, 0x65, 0x72, 0x63, 0x61, 0x72, 0x64}),
+						bertlv.NewTag("87", []byte{0x01}), // Application Priority Indicator
+					),
+				),
+			),
+		),
+		bertlv.NewTag("9F02", []byte{0x00, 0x00, 0x00, 0x00, 0x12, 0x34}),
+	}
+
+	expected, err := bertlv.Encode(data)
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	enc := bertlv.NewEncoder(&buf)
+	require.NoError(t, enc.Encode(data...))
+
+	require.Equal(t, expected, buf.Bytes())
+}
+
+func TestEncoderBeginEnd(t *testing.T) {
+	var buf bytes.Buffer
+	enc := bertlv.NewEncoder(&buf)
+
+	require.NoError(t, enc.Begin("70", 9))
+	require.NoError(t, enc.Encode(bertlv.NewTag("5A", []byte{0x41, 0x11})))
+	require.NoError(t, enc.Begin("A5", 3))
+	require.NoError(t, enc.Encode(bertlv.NewTag("87", []byte{0x01})))
+	require.NoError(t, enc.End())
+	require.NoError(t, enc.End())
+	require.NoError(t, enc.Encode(bertlv.NewTag("84", []byte{0xFF})))
+
+	require.Equal(t, "70095A024111A5038701018401FF", fmt.Sprintf("%X", buf.Bytes()))
+
+	decoded, err := bertlv.Decode(buf.Bytes())
+	require.NoError(t, err)
+	require.Equal(t, []bertlv.TLV{
+		bertlv.NewComposite("70",
+			bertlv.NewTag("5A", []byte{0x41, 0x11}),
+			bertlv.NewComposite("A5", bertlv.NewTag("87", []byte{0x01})),
+		),
+		bertlv.NewTag("84", []byte{0xFF}),
+	}, decoded)
+}
+
+func TestEncoderIndefiniteLength(t *testing.T) {
+	var buf bytes.Buffer
+	enc := bertlv.NewEncoder(&buf)
+
+	require.NoError(t, enc.BeginIndefinite("30"))
+	require.NoError(t, enc.Encode(bertlv.NewTag("02", []byte{0x01})))
+	require.NoError(t, enc.Begin("A0", 6))
+	require.NoError(t, enc.BeginIndefinite("30"))
+	require.NoError(t, enc.Encode(bertlv.NewTag("05", nil)))
+	require.NoError(t, enc.End())
+	require.NoError(t, enc.End())
+	require.NoError(t, enc.End())
+	require.NoError(t, enc.Encode(bertlv.TLV{Tag: "31", Indefinite: true, TLVs: []bertlv.TLV{
+		bertlv.NewTag("04", []byte{0xAA}),
+	}}))
+
+	require.Equal(t, "3080020101A006308005000000000031800401AA0000", fmt.Sprintf("%X", buf.Bytes()))
+
+	decoded, err := bertlv.Decode(buf.Bytes())
+	require.NoError(t, err)
+
+	encoded, err := bertlv.Encode(decoded)
+	require.NoError(t, err)
+	require.Equal(t, buf.Bytes(), encoded)
+
+	// the end-of-contents marker must fit into the definite length parent
+	enc = bertlv.NewEncoder(&bytes.Buffer{})
+	require.NoError(t, enc.Begin("A0", 3))
+	require.NoError(t, enc.BeginIndefinite("30"))
+	require.Error(t, enc.End())
+}
+
+func TestEncoderErrors(t *testing.T) {
+	t.Run("primitive tag in Begin", func(t *testing.T) {
+		enc := bertlv.NewEncoder(&bytes.Buffer{})
+		require.Error(t, enc.Begin("5A", 1))
+	})
+
+	t.Run("invalid tag", func(t *testing.T) {
+		enc := bertlv.NewEncoder(&bytes.Buffer{})
+		require.Error(t, enc.Encode(bertlv.NewTag("9F", []byte{0x01})))
+		require.Error(t, enc.Begin("ZZ", 1))
+	})
+
+	t.Run("children exceed announced length", func(t *testing.T) {
+		enc := bertlv.NewEncoder(&bytes.Buffer{})
+		require.NoError(t, enc.Begin("70", 2))
+		require.Error(t, enc.Encode(bertlv.NewTag("5A", []byte{0x41, 0x11})))
+	})
+
+	t.Run("End before all children are written", func(t *testing.T) {
+		enc := bertlv.NewEncoder(&bytes.Buffer{})
+		require.NoError(t, enc.Begin("70", 3))
+		require.Error(t, enc.End())
+	})
+
+	t.Run("End without Begin", func(t *testing.T) {
+		enc := bertlv.NewEncoder(&bytes.Buffer{})
+		require.Error(t, enc.End())
+	})
+
+	t.Run("write errors are sticky", func(t *testing.T) {
+		enc := bertlv.NewEncoder(failingWriter{})
+		err := enc.Encode(bertlv.NewTag("5A", []byte{0x41}))
+		require.ErrorIs(t, err, errWrite)
+
+		err = enc.Encode(bertlv.NewTag("5A", []byte{0x41}))
+		require.ErrorIs(t, err, errWrite)
+	})
+}
+
+var errWrite = errors.New("write failed")
+
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) {
+	return 0, errWrite
+}
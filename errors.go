@@ -0,0 +1,83 @@
+package bertlv
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	// ErrTruncated is returned when the data ends before a tag, length or
+	// value is complete.
+	ErrTruncated = errors.New("truncated data")
+
+	// ErrInvalidTag is returned when a tag is malformed.
+	ErrInvalidTag = errors.New("invalid tag")
+
+	// ErrInvalidLength is returned when a length is malformed or cannot be
+	// represented.
+	ErrInvalidLength = errors.New("invalid length")
+
+	// ErrNotFound is returned when a path does not lead to a TLV.
+	ErrNotFound = errors.New("not found")
+)
+
+// DecodeStage identifies the part of a data object that failed to decode.
+type DecodeStage int
+
+const (
+	StageTag DecodeStage = iota
+	StageLength
+	StageValue
+)
+
+func (s DecodeStage) String() string {
+	switch s {
+	case StageTag:
+		return "tag"
+	case StageLength:
+		return "length"
+	case StageValue:
+		return "value"
+	default:
+		return fmt.Sprintf("DecodeStage(%d)", int(s))
+	}
+}
+
+// DecodeError describes where decoding failed. Err wraps one of the
+// package sentinels (ErrTruncated, ErrInvalidTag, ErrInvalidLength,
+// ErrNonCanonical), so the cause can be checked with errors.Is.
+type DecodeError struct {
+	// Offset is the absolute offset in the input of the tag, length or
+	// value that failed to decode.
+	Offset int
+	// Path is the dotted tag path of the failing data object, e.g. "70.57".
+	// When the tag itself cannot be read, it is the path of the enclosing
+	// constructed data object (empty at the top level).
+	Path string
+	// Stage is the part of the data object that failed to decode.
+	Stage DecodeStage
+	Err   error
+}
+
+func (e *DecodeError) Error() string {
+	if e.Path == "" {
+		return fmt.Sprintf("reading %s at offset %d: %v", e.Stage, e.Offset, e.Err)
+	}
+
+	return fmt.Sprintf("reading %s at offset %d (path %s): %v", e.Stage, e.Offset, e.Path, e.Err)
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// newDecodeError builds a DecodeError for the data object at path.
+func newDecodeError(offset int, path []string, stage DecodeStage, err error) *DecodeError {
+	return &DecodeError{
+		Offset: offset,
+		Path:   strings.Join(path, "."),
+		Stage:  stage,
+		Err:    err,
+	}
+}
@@ -0,0 +1,127 @@
+package bertlv_test
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"testing"
+
+	"github.com/moov-io/bertlv"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodeError(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     string
+		offset   int
+		path     string
+		stage    bertlv.DecodeStage
+		sentinel error
+	}{
+		{
+			name:     "incomplete tag",
+			data:     "9F",
+			offset:   0,
+			stage:    bertlv.StageTag,
+			sentinel: bertlv.ErrTruncated,
+		},
+		{
+			name:     "missing length",
+			data:     "5A",
+			offset:   1,
+			path:     "5A",
+			stage:    bertlv.StageLength,
+			sentinel: bertlv.ErrTruncated,
+		},
+		{
+			name:     "length field too large",
+			data:     "5A89010203040506070809",
+			offset:   1,
+			path:     "5A",
+			stage:    bertlv.StageLength,
+			sentinel: bertlv.ErrInvalidLength,
+		},
+		{
+			name:     "truncated value",
+			data:     "5A0411",
+			offset:   2,
+			path:     "5A",
+			stage:    bertlv.StageValue,
+			sentinel: bertlv.ErrTruncated,
+		},
+		{
+			name:     "truncated nested value",
+			data:     "6F09840101" + "7004" + "5A051122",
+			offset:   9,
+			path:     "6F.70.5A",
+			stage:    bertlv.StageValue,
+			sentinel: bertlv.ErrTruncated,
+		},
+		{
+			name:     "incomplete nested tag",
+			data:     "70045701119F",
+			offset:   5,
+			path:     "70",
+			stage:    bertlv.StageTag,
+			sentinel: bertlv.ErrTruncated,
+		},
+		{
+			name:     "indefinite length primitive",
+			data:     "70035A8000",
+			offset:   3,
+			path:     "70.5A",
+			stage:    bertlv.StageLength,
+			sentinel: bertlv.ErrInvalidLength,
+		},
+		{
+			name:     "missing end-of-contents",
+			data:     "30805A0111",
+			offset:   5,
+			path:     "30",
+			stage:    bertlv.StageValue,
+			sentinel: bertlv.ErrTruncated,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := hex.DecodeString(tt.data)
+			require.NoError(t, err)
+
+			_, err = bertlv.Decode(data)
+			requireDecodeError(t, err, tt.offset, tt.path, tt.stage, tt.sentinel)
+
+			// the streaming decoder reports the same location
+			dec := bertlv.NewDecoder(bytes.NewReader(data))
+			for err = nil; err == nil; {
+				_, err = dec.Next()
+			}
+			requireDecodeError(t, err, tt.offset, tt.path, tt.stage, tt.sentinel)
+		})
+	}
+
+	t.Run("DER violation", func(t *testing.T) {
+		_, err := bertlv.DecodeWithOptions([]byte{0x70, 0x04, 0x5A, 0x81, 0x01, 0xAA}, bertlv.DecodeOptions{DER: true})
+		requireDecodeError(t, err, 3, "70.5A", bertlv.StageLength, bertlv.ErrNonCanonical)
+	})
+
+	t.Run("message", func(t *testing.T) {
+		_, err := bertlv.Decode([]byte{0x70, 0x03, 0x57, 0x04, 0x11})
+		require.EqualError(t, err, "reading value at offset 4 (path 70.57): truncated data: insufficient data for expected length 4")
+
+		_, err = bertlv.Decode([]byte{0x9F})
+		require.EqualError(t, err, "reading tag at offset 0: truncated data: tag is incomplete")
+	})
+}
+
+func requireDecodeError(t *testing.T, err error, offset int, path string, stage bertlv.DecodeStage, sentinel error) {
+	t.Helper()
+
+	var decodeErr *bertlv.DecodeError
+	require.True(t, errors.As(err, &decodeErr), "expected *DecodeError, got %v", err)
+	require.Equal(t, offset, decodeErr.Offset)
+	require.Equal(t, path, decodeErr.Path)
+	require.Equal(t, stage, decodeErr.Stage)
+	require.ErrorIs(t, err, sentinel)
+}
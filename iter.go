@@ -0,0 +1,92 @@
+package bertlv
+
+import (
+	"iter"
+	"strings"
+)
+
+// Path holds the tags leading to a TLV, from the top level down to and
+// including the TLV itself.
+type Path []string
+
+// String returns the tags joined with ".", as accepted by FindTagByPath.
+func (p Path) String() string {
+	return strings.Join(p, ".")
+}
+
+// All returns an iterator over all TLVs and their paths in depth-first
+// order. Like in Walk, the path is reused between iterations; clone it to
+// keep it.
+func All(tlvs []TLV) iter.Seq2[Path, TLV] {
+	return func(yield func(Path, TLV) bool) {
+		Walk(tlvs, func(path []string, tlv *TLV) WalkAction {
+			if !yield(path, *tlv) {
+				return WalkStop
+			}
+
+			return WalkContinue
+		})
+	}
+}
+
+// Primitives returns an iterator over the primitive TLVs and their paths
+// in depth-first order.
+func Primitives(tlvs []TLV) iter.Seq2[Path, TLV] {
+	return func(yield func(Path, TLV) bool) {
+		for path, tlv := range All(tlvs) {
+			if isPrimitive(&tlv) && !yield(path, tlv) {
+				return
+			}
+		}
+	}
+}
+
+// ByTag returns an iterator over the TLVs with the specified tag and their
+// paths in depth-first order. The tag is matched as described in
+// NormalizeTag.
+func ByTag(tlvs []TLV, tag string) iter.Seq2[Path, TLV] {
+	return func(yield func(Path, TLV) bool) {
+		tag, err := NormalizeTag(tag)
+		if err != nil {
+			return
+		}
+
+		for path, tlv := range All(tlvs) {
+			if sameTag(tlv.Tag, tag) && !yield(path, tlv) {
+				return
+			}
+		}
+	}
+}
+
+// Children returns an iterator over the direct children of tlv. Like
+// TLV.Children, it first decodes the children of a TLV decoded with
+// DecodeOptions.Lazy, storing them in tlv; if that fails, the error is
+// yielded once with an empty TLV.
+func Children(tlv *TLV) iter.Seq2[TLV, error] {
+	return func(yield func(TLV, error) bool) {
+		children, err := tlv.Children()
+		if err != nil {
+			yield(TLV{}, err)
+			return
+		}
+
+		for _, child := range children {
+			if !yield(child, nil) {
+				return
+			}
+		}
+	}
+}
+
+// isPrimitive reports whether the tag of tlv is primitive. TLVs with a
+// malformed tag are primitive unless they have children.
+func isPrimitive(tlv *TLV) bool {
+	var buf [maxTagBuffer]byte
+	tag, err := appendTag(buf[:0], tlv.Tag)
+	if err != nil {
+		return len(tlv.TLVs) == 0
+	}
+
+	return !isConstructed(tag)
+}
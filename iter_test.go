@@ -0,0 +1,114 @@
+package bertlv_test
+
+import (
+	"encoding/hex"
+	"slices"
+	"testing"
+
+	"github.com/moov-io/bertlv"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAll(t *testing.T) {
+	var paths []string
+
+	for path, tlv := range bertlv.All(testTLVs()) {
+		require.Equal(t, tlv.Tag, path[len(path)-1])
+		paths = append(paths, path.String())
+	}
+
+	require.Equal(t, testPaths, paths)
+
+	// breaking out of the loop stops the iteration
+	var visited []string
+	for _, tlv := range bertlv.All(testTLVs()) {
+		visited = append(visited, tlv.Tag)
+		if tlv.Tag == "A5" {
+			break
+		}
+	}
+
+	require.Equal(t, []string{"6F", "84", "A5"}, visited)
+}
+
+func TestPrimitives(t *testing.T) {
+	tlvs := append(testTLVs(),
+		// empty template is not primitive
+		bertlv.NewComposite("A5"),
+	)
+
+	var paths []string
+	for path := range bertlv.Primitives(tlvs) {
+		paths = append(paths, path.String())
+	}
+
+	require.Equal(t, []string{
+		"6F.84", "6F.A5.BF0C.61.4F", "6F.A5.BF0C.61.50", "6F.A5.BF0C.61.4F", "6F.A5.BF0C.61.50",
+		"70.57", "70.57", "70.77.9F10", "9F10",
+	}, paths)
+}
+
+func TestByTag(t *testing.T) {
+	tlvs := []bertlv.TLV{
+		bertlv.NewComposite("70", bertlv.NewTag("5A", []byte{0x01})),
+		bertlv.NewComposite("77", bertlv.NewTag("5A", []byte{0x02})),
+	}
+
+	var paths []bertlv.Path
+	var values [][]byte
+	for path, tlv := range bertlv.ByTag(tlvs, "5a") {
+		paths = append(paths, slices.Clone(path))
+		values = append(values, tlv.Value)
+	}
+
+	require.Equal(t, []bertlv.Path{{"70", "5A"}, {"77", "5A"}}, paths)
+	require.Equal(t, [][]byte{{0x01}, {0x02}}, values)
+
+	for range bertlv.ByTag(tlvs, "XYZ") {
+		t.Fatal("malformed tag must not match")
+	}
+}
+
+func TestChildren(t *testing.T) {
+	tlv := testTLVs()[0]
+
+	var tags []string
+	for child, err := range bertlv.Children(&tlv) {
+		require.NoError(t, err)
+		tags = append(tags, child.Tag)
+	}
+
+	require.Equal(t, []string{"84", "A5"}, tags)
+
+	for range bertlv.Children(&bertlv.TLV{Tag: "5A"}) {
+		t.Fatal("primitive TLV has no children")
+	}
+}
+
+func TestChildrenLazy(t *testing.T) {
+	data, err := hex.DecodeString("7006" + "5A0111" + "570122" + "7702" + "5A05")
+	require.NoError(t, err)
+
+	tlvs, err := bertlv.DecodeWithOptions(data, bertlv.DecodeOptions{Lazy: true})
+	require.NoError(t, err)
+
+	// the children are decoded and kept
+	var tags []string
+	for child, err := range bertlv.Children(&tlvs[0]) {
+		require.NoError(t, err)
+		tags = append(tags, child.Tag)
+	}
+
+	require.Equal(t, []string{"5A", "57"}, tags)
+	require.Len(t, tlvs[0].TLVs, 2)
+
+	// decoding errors are yielded
+	var errs []error
+	for child, err := range bertlv.Children(&tlvs[1]) {
+		require.Zero(t, child)
+		errs = append(errs, err)
+	}
+
+	require.Len(t, errs, 1)
+	require.ErrorIs(t, errs[0], bertlv.ErrTruncated)
+}
@@ -0,0 +1,136 @@
+package bertlv
+
+import (
+	"fmt"
+)
+
+// maxLengthBytes is the maximum number of bytes of a long form length.
+const maxLengthBytes = 8
+
+// LengthForm selects how EncodeWithOptions encodes lengths.
+type LengthForm int
+
+const (
+	// LengthMinimal uses the short form for lengths below 128 and the
+	// shortest long form otherwise. It is the default.
+	LengthMinimal LengthForm = iota
+	// LengthLong always uses the long form with the fewest length bytes,
+	// e.g. 81 05 or 82 01 00.
+	LengthLong
+	// LengthFixed always uses the long form with LengthEncoding.Width
+	// length bytes, e.g. 82 00 05 for a width of 2.
+	LengthFixed
+)
+
+func (f LengthForm) String() string {
+	switch f {
+	case LengthMinimal:
+		return "minimal"
+	case LengthLong:
+		return "long"
+	case LengthFixed:
+		return "fixed"
+	default:
+		return fmt.Sprintf("LengthForm(%d)", int(f))
+	}
+}
+
+// LengthEncoding describes how lengths are encoded.
+type LengthEncoding struct {
+	Form LengthForm
+	// Width is the number of length bytes following the initial byte when
+	// Form is LengthFixed, from 1 to 8.
+	Width int
+}
+
+// size returns the number of bytes of the encoded length, or an error if
+// length cannot be encoded this way.
+func (e LengthEncoding) size(length int) (int, error) {
+	switch e.Form {
+	case LengthMinimal:
+		return encodedLengthSize(length), nil
+	case LengthLong:
+		return 1 + longLengthBytes(length), nil
+	case LengthFixed:
+		if e.Width < 1 || e.Width > maxLengthBytes {
+			return 0, fmt.Errorf("%w: width %d is not between 1 and %d", ErrInvalidLength, e.Width, maxLengthBytes)
+		}
+
+		if longLengthBytes(length) > e.Width {
+			return 0, fmt.Errorf("%w: length %d does not fit in %d bytes", ErrInvalidLength, length, e.Width)
+		}
+
+		return 1 + e.Width, nil
+	default:
+		return 0, fmt.Errorf("%w: unknown length form %v", ErrInvalidLength, e.Form)
+	}
+}
+
+// append appends the encoded length to dst. The length must have been
+// accepted by size.
+func (e LengthEncoding) append(dst []byte, length int) []byte {
+	switch e.Form {
+	case LengthLong:
+		return appendLongLength(dst, length, longLengthBytes(length))
+	case LengthFixed:
+		return appendLongLength(dst, length, e.Width)
+	default:
+		return appendLength(dst, length)
+	}
+}
+
+// lengthEncoding returns the length encoding for the tag.
+func (o EncodeOptions) lengthEncoding(tag string) LengthEncoding {
+	if len(o.TagLengths) > 0 {
+		tag = normalizeTag(tag)
+		if e, ok := o.TagLengths[tag]; ok {
+			return e
+		}
+
+		for t, e := range o.TagLengths {
+			if sameTag(t, tag) {
+				return e
+			}
+		}
+	}
+
+	return o.Length
+}
+
+// minimalLengths reports whether all lengths use the minimal encoding.
+func (o EncodeOptions) minimalLengths() bool {
+	if o.Length.Form != LengthMinimal {
+		return false
+	}
+
+	for _, e := range o.TagLengths {
+		if e.Form != LengthMinimal {
+			return false
+		}
+	}
+
+	return true
+}
+
+// longLengthBytes returns the fewest number of bytes holding length in the
+// long form.
+func longLengthBytes(length int) int {
+	n := 1
+	for length > 0xFF {
+		n++
+		length >>= 8
+	}
+
+	return n
+}
+
+// appendLongLength appends length in the long form using n length bytes.
+func appendLongLength(dst []byte, length, n int) []byte {
+	// n is small (<= 8); the masks keep the conversions provably in range
+	dst = append(dst, byte((0b1000_0000|n)&0xFF))
+	for i := n - 1; i >= 0; i-- {
+		dst = append(dst, byte((length>>(8*i))&0xFF))
+	}
+
+	return dst
+}
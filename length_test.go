@@ -0,0 +1,87 @@
+package bertlv_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/moov-io/bertlv"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncodeLengthForms(t *testing.T) {
+	tlvs := []bertlv.TLV{
+		bertlv.NewComposite("70",
+			bertlv.NewTag("5A", []byte{0x11}),
+		),
+		bertlv.NewTag("9F10", make([]byte, 200)),
+	}
+	long := fmt.Sprintf("%0400X", 0)
+
+	tests := []struct {
+		name     string
+		opts     bertlv.EncodeOptions
+		expected string
+	}{
+		{
+			name:     "minimal",
+			expected: "7003" + "5A0111" + "9F1081C8" + long,
+		},
+		{
+			name:     "long",
+			opts:     bertlv.EncodeOptions{Length: bertlv.LengthEncoding{Form: bertlv.LengthLong}},
+			expected: "708104" + "5A810111" + "9F1081C8" + long,
+		},
+		{
+			name:     "fixed",
+			opts:     bertlv.EncodeOptions{Length: bertlv.LengthEncoding{Form: bertlv.LengthFixed, Width: 2}},
+			expected: "70820005" + "5A82000111" + "9F108200C8" + long,
+		},
+		{
+			name: "per tag",
+			opts: bertlv.EncodeOptions{TagLengths: map[string]bertlv.LengthEncoding{
+				"5a": {Form: bertlv.LengthFixed, Width: 3},
+			}},
+			expected: "7006" + "5A8300000111" + "9F1081C8" + long,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encoded, err := bertlv.EncodeWithOptions(tlvs, tt.opts)
+			require.NoError(t, err)
+			require.Equal(t, tt.expected, fmt.Sprintf("%X", encoded))
+
+			// any length form decodes to the same TLVs
+			decoded, err := bertlv.Decode(encoded)
+			require.NoError(t, err)
+			require.Equal(t, tlvs, decoded)
+		})
+	}
+}
+
+func TestEncodeLengthFormErrors(t *testing.T) {
+	tlvs := []bertlv.TLV{bertlv.NewTag("9F10", make([]byte, 256))}
+
+	_, err := bertlv.EncodeWithOptions(tlvs, bertlv.EncodeOptions{
+		Length: bertlv.LengthEncoding{Form: bertlv.LengthFixed, Width: 1},
+	})
+	require.ErrorIs(t, err, bertlv.ErrInvalidLength)
+	require.ErrorContains(t, err, "length 256 does not fit in 1 bytes")
+
+	_, err = bertlv.EncodeWithOptions(tlvs, bertlv.EncodeOptions{
+		Length: bertlv.LengthEncoding{Form: bertlv.LengthFixed},
+	})
+	require.ErrorIs(t, err, bertlv.ErrInvalidLength)
+
+	// lengths of nested values are validated too
+	_, err = bertlv.EncodeWithOptions([]bertlv.TLV{bertlv.NewComposite("70", tlvs...)}, bertlv.EncodeOptions{
+		TagLengths: map[string]bertlv.LengthEncoding{"9F10": {Form: bertlv.LengthFixed, Width: 1}},
+	})
+	require.ErrorIs(t, err, bertlv.ErrInvalidLength)
+
+	_, err = bertlv.EncodeWithOptions(tlvs, bertlv.EncodeOptions{
+		DER:    true,
+		Length: bertlv.LengthEncoding{Form: bertlv.LengthLong},
+	})
+	require.Error(t, err)
+}
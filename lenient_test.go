@@ -0,0 +1,142 @@
+package bertlv_test
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	"github.com/moov-io/bertlv"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodeLenient(t *testing.T) {
+	t.Run("valid input", func(t *testing.T) {
+		data, err := hex.DecodeString("6F2F840E325041592E5359532E4444463031A51DBF0C1A61184F07A0000000041010500A4D617374657263617264870101")
+		require.NoError(t, err)
+
+		expected, err := bertlv.Decode(data)
+		require.NoError(t, err)
+
+		tlvs, problems := bertlv.DecodeLenient(data, bertlv.DecodeOptions{})
+		require.Empty(t, problems)
+		require.Equal(t, expected, tlvs)
+	})
+
+	t.Run("truncated trailing value", func(t *testing.T) {
+		data, err := hex.DecodeString("9F0206000000001234" + "5A08411111")
+		require.NoError(t, err)
+
+		tlvs, problems := bertlv.DecodeLenient(data, bertlv.DecodeOptions{})
+		require.Equal(t, []bertlv.TLV{
+			bertlv.NewTag("9F02", []byte{0x00, 0x00, 0x00, 0x00, 0x12, 0x34}),
+		}, tlvs)
+		require.Len(t, problems, 1)
+		require.Equal(t, 11, problems[0].Offset)
+		require.Equal(t, "5A", problems[0].Path)
+		require.ErrorIs(t, problems[0], bertlv.ErrTruncated)
+
+		tlvs, _ = bertlv.DecodeLenient(data, bertlv.DecodeOptions{KeepRemainder: true})
+		require.Equal(t, []bertlv.TLV{
+			bertlv.NewTag("9F02", []byte{0x00, 0x00, 0x00, 0x00, 0x12, 0x34}),
+			{Raw: true, Value: []byte{0x5A, 0x08, 0x41, 0x11, 0x11}},
+		}, tlvs)
+	})
+
+	t.Run("corrupt constructed values", func(t *testing.T) {
+		data, err := hex.DecodeString("7007" + "5701AA" + "5A051122" + "8401FF" + "7701" + "9F")
+		require.NoError(t, err)
+
+		_, err = bertlv.Decode(data)
+		require.Error(t, err)
+
+		tlvs, problems := bertlv.DecodeLenient(data, bertlv.DecodeOptions{})
+		require.Equal(t, []bertlv.TLV{
+			bertlv.NewComposite("70", bertlv.NewTag("57", []byte{0xAA})),
+			bertlv.NewTag("84", []byte{0xFF}),
+			{Tag: "77"},
+		}, tlvs)
+
+		require.Len(t, problems, 2)
+		require.Equal(t, "70.5A", problems[0].Path)
+		require.Equal(t, bertlv.StageValue, problems[0].Stage)
+		require.Equal(t, "77", problems[1].Path)
+		require.Equal(t, bertlv.StageTag, problems[1].Stage)
+		require.Equal(t, 14, problems[1].Offset)
+
+		tlvs, _ = bertlv.DecodeLenient(data, bertlv.DecodeOptions{KeepRemainder: true})
+		require.Equal(t, []bertlv.TLV{
+			bertlv.NewComposite("70",
+				bertlv.NewTag("57", []byte{0xAA}),
+				bertlv.TLV{Raw: true, Value: []byte{0x5A, 0x05, 0x11, 0x22}},
+			),
+			bertlv.NewTag("84", []byte{0xFF}),
+			bertlv.NewComposite("77", bertlv.TLV{Raw: true, Value: []byte{0x9F}}),
+		}, tlvs)
+
+		// the remainders are written back as they were
+		encoded, err := bertlv.Encode(tlvs)
+		require.NoError(t, err)
+		require.Equal(t, data, encoded)
+	})
+
+	t.Run("bad tag at top level", func(t *testing.T) {
+		data, err := hex.DecodeString("5701AA" + "9F")
+		require.NoError(t, err)
+
+		tlvs, problems := bertlv.DecodeLenient(data, bertlv.DecodeOptions{KeepRemainder: true})
+		require.Equal(t, []bertlv.TLV{
+			bertlv.NewTag("57", []byte{0xAA}),
+			{Raw: true, Value: []byte{0x9F}},
+		}, tlvs)
+		require.Len(t, problems, 1)
+		require.Equal(t, 3, problems[0].Offset)
+		require.Equal(t, bertlv.StageTag, problems[0].Stage)
+	})
+
+	t.Run("missing end-of-contents", func(t *testing.T) {
+		tlvs, problems := bertlv.DecodeLenient([]byte{0x30, 0x80}, bertlv.DecodeOptions{KeepRemainder: true})
+		require.Len(t, problems, 1)
+
+		// the TLV is encoded complete
+		encoded, err := bertlv.Encode(tlvs)
+		require.NoError(t, err)
+		require.Equal(t, []byte{0x30, 0x80, 0x00, 0x00}, encoded)
+	})
+}
+
+func TestEncodeRaw(t *testing.T) {
+	tlvs := []bertlv.TLV{
+		bertlv.NewTag("57", []byte{0xAA}),
+		{Raw: true, Value: []byte{0x5A, 0x05, 0x11}},
+	}
+
+	encoded, err := bertlv.Encode(tlvs)
+	require.NoError(t, err)
+	require.Equal(t, []byte{0x57, 0x01, 0xAA, 0x5A, 0x05, 0x11}, encoded)
+
+	size, err := bertlv.EncodedLen(tlvs)
+	require.NoError(t, err)
+	require.Equal(t, len(encoded), size)
+
+	_, err = bertlv.EncodeWithOptions(tlvs, bertlv.EncodeOptions{DER: true})
+	require.Error(t, err)
+
+	var buf bytes.Buffer
+	require.NoError(t, bertlv.NewEncoder(&buf).Encode(tlvs[1]))
+	require.Equal(t, []byte{0x5A, 0x05, 0x11}, buf.Bytes())
+
+	_, err = bertlv.Encode([]bertlv.TLV{{Raw: true, TLVs: tlvs}})
+	require.Error(t, err)
+
+	_, err = bertlv.Encode([]bertlv.TLV{{Raw: true, Tag: "57", Value: []byte{0xAA}}})
+	require.Error(t, err)
+
+	// a TLV without a tag is not raw
+	_, err = bertlv.Encode([]bertlv.TLV{{}})
+	require.ErrorIs(t, err, bertlv.ErrInvalidTag)
+
+	_, err = bertlv.Encode([]bertlv.TLV{{Value: []byte{0x5A, 0x05, 0x11}}})
+	require.ErrorIs(t, err, bertlv.ErrInvalidTag)
+
+	require.Error(t, bertlv.NewEncoder(&buf).Encode(bertlv.TLV{Value: []byte{0x01}}))
+}
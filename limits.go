@@ -0,0 +1,77 @@
+package bertlv
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+)
+
+var (
+	// ErrTooDeep is returned when data objects are nested deeper than
+	// DecodeOptions.MaxDepth.
+	ErrTooDeep = errors.New("nesting too deep")
+
+	// ErrTooManyElements is returned when the input holds more data objects
+	// than DecodeOptions.MaxElements.
+	ErrTooManyElements = errors.New("too many elements")
+
+	// ErrTagTooLong is returned when a tag is longer than
+	// DecodeOptions.MaxTagLength.
+	ErrTagTooLong = errors.New("tag too long")
+
+	// ErrValueTooLarge is returned when a value is longer than
+	// DecodeOptions.MaxValueSize.
+	ErrValueTooLarge = errors.New("value too large")
+)
+
+// checkTag validates a tag found at the given depth as the n-th data object
+// of the input.
+func (o DecodeOptions) checkTag(tag []byte, depth, n int) error {
+	if o.MaxDepth > 0 && depth > o.MaxDepth {
+		return fmt.Errorf("%w: depth %d exceeds %d", ErrTooDeep, depth, o.MaxDepth)
+	}
+
+	if o.MaxElements > 0 && n > o.MaxElements {
+		return fmt.Errorf("%w: more than %d", ErrTooManyElements, o.MaxElements)
+	}
+
+	if o.MaxTagLength > 0 && len(tag) > o.MaxTagLength {
+		return fmt.Errorf("%w: %d bytes exceeds %d", ErrTagTooLong, len(tag), o.MaxTagLength)
+	}
+
+	if o.DER {
+		return checkMinimalTag(tag)
+	}
+
+	return nil
+}
+
+// checkLength validates a length decoded from read bytes.
+func (o DecodeOptions) checkLength(length, read int) error {
+	if o.DER {
+		if err := checkMinimalLength(length, read); err != nil {
+			return err
+		}
+	}
+
+	if o.MaxValueSize > 0 && length > o.MaxValueSize {
+		return fmt.Errorf("%w: %d bytes exceeds %d", ErrValueTooLarge, length, o.MaxValueSize)
+	}
+
+	return nil
+}
+
+// isOpaque reports whether the value of the constructed tag is kept as is.
+func (o DecodeOptions) isOpaque(tag string) bool {
+	return slices.ContainsFunc(o.OpaqueTags, func(opaque string) bool {
+		return sameTag(opaque, tag)
+	})
+}
+
+// isNested reports whether the value of the primitive tag is decoded as
+// nested data objects.
+func (o DecodeOptions) isNested(tag string) bool {
+	return o.NestedHeuristic || slices.ContainsFunc(o.NestedTags, func(nested string) bool {
+		return sameTag(nested, tag)
+	})
+}
@@ -0,0 +1,93 @@
+package bertlv_test
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	"github.com/moov-io/bertlv"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodeLimits(t *testing.T) {
+	// 6F { 84, A5 { BF0C { 61 { 4F, 50, 87 } } } }: 9 data objects, depth 5
+	data, err := hex.DecodeString("6F2F840E325041592E5359532E4444463031A51DBF0C1A61184F07A0000000041010500A4D617374657263617264870101")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		opts     bertlv.DecodeOptions
+		sentinel error
+		path     string
+	}{
+		{
+			name:     "max depth",
+			opts:     bertlv.DecodeOptions{MaxDepth: 3},
+			sentinel: bertlv.ErrTooDeep,
+			path:     "6F.A5.BF0C.61",
+		},
+		{
+			name:     "max elements",
+			opts:     bertlv.DecodeOptions{MaxElements: 6},
+			sentinel: bertlv.ErrTooManyElements,
+			path:     "6F.A5.BF0C.61.50",
+		},
+		{
+			name:     "max tag length",
+			opts:     bertlv.DecodeOptions{MaxTagLength: 1},
+			sentinel: bertlv.ErrTagTooLong,
+			path:     "6F.A5.BF0C",
+		},
+		{
+			name:     "max value size",
+			opts:     bertlv.DecodeOptions{MaxValueSize: 20},
+			sentinel: bertlv.ErrValueTooLarge,
+			path:     "6F",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := bertlv.DecodeWithOptions(data, tt.opts)
+			require.ErrorIs(t, err, tt.sentinel)
+
+			var decodeErr *bertlv.DecodeError
+			require.ErrorAs(t, err, &decodeErr)
+			require.Equal(t, tt.path, decodeErr.Path)
+
+			dec := bertlv.NewDecoderWithOptions(bytes.NewReader(data), tt.opts)
+			_, err = dec.Next()
+			require.ErrorIs(t, err, tt.sentinel)
+		})
+	}
+
+	t.Run("within limits", func(t *testing.T) {
+		opts := bertlv.DecodeOptions{MaxDepth: 5, MaxElements: 9, MaxTagLength: 2, MaxValueSize: 47}
+
+		expected, err := bertlv.Decode(data)
+		require.NoError(t, err)
+
+		tlvs, err := bertlv.DecodeWithOptions(data, opts)
+		require.NoError(t, err)
+		require.Equal(t, expected, tlvs)
+
+		tlv, err := bertlv.NewDecoderWithOptions(bytes.NewReader(data), opts).Next()
+		require.NoError(t, err)
+		require.Equal(t, expected[0], tlv)
+	})
+
+	t.Run("streaming tag length is bounded", func(t *testing.T) {
+		hostile := append([]byte{0x9F}, bytes.Repeat([]byte{0xFF}, 1<<16)...)
+
+		dec := bertlv.NewDecoderWithOptions(bytes.NewReader(hostile), bertlv.DecodeOptions{MaxTagLength: 4})
+		_, err := dec.Next()
+		require.ErrorIs(t, err, bertlv.ErrTagTooLong)
+		require.Less(t, dec.InputOffset(), 16)
+	})
+
+	t.Run("streaming DER", func(t *testing.T) {
+		dec := bertlv.NewDecoderWithOptions(bytes.NewReader([]byte{0x5A, 0x81, 0x01, 0xAA}), bertlv.DecodeOptions{DER: true})
+		_, err := dec.Next()
+		require.ErrorIs(t, err, bertlv.ErrNonCanonical)
+	})
+}
@@ -44,15 +44,13 @@ func BuildTagMap(tlvs []TLV) map[string][]TLV {
 // flattenTags recursively adds all tags from the TLV structure to the map.
 // Uses depth-first traversal to maintain consistent ordering for duplicate tags.
 func flattenTags(tlvs []TLV, tagMap map[string][]TLV) {
-	for _, tlv := range tlvs {
+	Walk(tlvs, func(_ []string, tlv *TLV) WalkAction {
 		// Always append - preserve all instances
-		tagMap[tlv.Tag] = append(tagMap[tlv.Tag], tlv)
+		tag := normalizeTag(tlv.Tag)
+		tagMap[tag] = append(tagMap[tag], *tlv)
 
-		// Recursively process nested TLVs
-		if len(tlv.TLVs) > 0 {
-			flattenTags(tlv.TLVs, tagMap)
-		}
-	}
+		return WalkContinue
+	})
 }
 
 // estimateTagCount provides a rough estimate of total tags for map sizing.
@@ -73,7 +71,7 @@ func estimateTagCount(tlvs []TLV) int {
 // FindFirst returns the first occurrence of a tag from the tag map.
 // This is useful when you only need one instance of a tag.
 func FindFirst(tagMap map[string][]TLV, tag string) (TLV, bool) {
-	instances, found := tagMap[tag]
+	instances, found := tagMap[normalizeTag(tag)]
 	if !found || len(instances) == 0 {
 		return TLV{}, false
 	}
@@ -84,7 +82,7 @@ func FindFirst(tagMap map[string][]TLV, tag string) (TLV, bool) {
 // This is essential for processing duplicate tags within constructed TLVs,
 // which is common in EMV data where tags like 9F10 appear in multiple templates.
 func Find(tagMap map[string][]TLV, tag string) ([]TLV, bool) {
-	instances, found := tagMap[tag]
+	instances, found := tagMap[normalizeTag(tag)]
 	return instances, found && len(instances) > 0
 }
 
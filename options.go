@@ -0,0 +1,99 @@
+package bertlv
+
+// DecodeOptions configures DecodeWithOptions. The zero value decodes BER as
+// Decode does.
+type DecodeOptions struct {
+	// DER enables strict Distinguished Encoding Rules validation. Lengths
+	// and tags must use their shortest encoding, the indefinite length form
+	// is rejected, and so is padding between data objects. Violations are
+	// reported with ErrNonCanonical.
+	DER bool
+
+	// KeepRemainder makes DecodeLenient keep the bytes it could not decode
+	// as a TLV with TLV.Raw set at the position where decoding stopped.
+	// Encode writes them back as they were. The TLVs that were cut short
+	// are still encoded complete, though: an indefinite length TLV without
+	// end-of-contents gets one, for example.
+	KeepRemainder bool
+
+	// Lazy defers decoding the children of definite length constructed
+	// TLVs until TLV.Children is called. Until then they are kept in Value
+	// (and encoded from there), so functions that walk TLVs do not see
+	// them. Lazy does not apply to DecodeLenient.
+	Lazy bool
+
+	// Copy makes the decoded TLVs independent of the input. By default,
+	// values (and Source) are slices of the input, so modifying or reusing
+	// the input buffer changes them. With Copy, the input is copied once
+	// and the TLVs share that private copy instead.
+	Copy bool
+
+	// KeepSource records on each TLV where it was found in the input, its
+	// original header and raw bytes, and the padding around it (see
+	// Source). Encoding with EncodeOptions.Preserve uses it to reproduce
+	// the input byte for byte.
+	KeepSource bool
+
+	// Padding selects which filler bytes are skipped between data objects.
+	// The default skips 00 bytes.
+	Padding PaddingMode
+	// OnPadding, if set, is called for every run of padding bytes with its
+	// offset in the input and its length. Padding inside values decoded
+	// for NestedTags is not reported.
+	OnPadding func(offset, length int)
+
+	// OpaqueTags lists constructed tags whose value is not BER-TLV encoded,
+	// such as proprietary templates. Their content is kept in Value instead
+	// of being decoded into TLVs. Opaque tags using the indefinite length
+	// form are decoded as usual, as their end can only be found by decoding
+	// their content.
+	OpaqueTags []string
+
+	// NestedTags lists primitive tags whose value holds BER-TLV data
+	// objects, such as issuer discretionary data. Their value is decoded
+	// into TLVs as well, while Value keeps the original bytes and remains
+	// what is encoded. Values that do not decode cleanly are left without
+	// TLVs.
+	NestedTags []string
+	// NestedHeuristic applies NestedTags to every primitive tag: values
+	// that decode cleanly into data objects get TLVs. Short binary values
+	// may decode by chance, so prefer NestedTags for known tags.
+	NestedHeuristic bool
+
+	// The limits below protect against hostile input. Zero means no limit.
+
+	// MaxDepth is the maximum nesting depth; top level data objects are at
+	// depth 1. Exceeding it returns ErrTooDeep.
+	MaxDepth int
+	// MaxElements is the maximum number of data objects in the input.
+	// Exceeding it returns ErrTooManyElements.
+	MaxElements int
+	// MaxTagLength is the maximum length of a tag in bytes. Exceeding it
+	// returns ErrTagTooLong.
+	MaxTagLength int
+	// MaxValueSize is the maximum length of a value in bytes, including
+	// the encoded children of constructed data objects. Exceeding it
+	// returns ErrValueTooLarge.
+	MaxValueSize int
+}
+
+// EncodeOptions configures EncodeWithOptions. The zero value encodes BER as
+// Encode does.
+type EncodeOptions struct {
+	// DER enables Distinguished Encoding Rules: the elements of a SET OF
+	// (universal tag 31) are sorted by their encodings and the indefinite
+	// length form is rejected.
+	DER bool
+
+	// Preserve reproduces the original encoding of TLVs decoded with
+	// DecodeOptions.KeepSource: their padding is restored and their
+	// original length bytes are kept as long as they still encode the
+	// length of the value. TLVs without Source are encoded as usual.
+	Preserve bool
+
+	// Length selects how lengths are encoded. The default uses the
+	// shortest form, which DER requires.
+	Length LengthEncoding
+	// TagLengths overrides Length for specific tags.
+	TagLengths map[string]LengthEncoding
+}
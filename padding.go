@@ -0,0 +1,71 @@
+package bertlv
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrUnexpectedPadding is returned when padding is found that the
+// PaddingMode of the decode options does not allow.
+var ErrUnexpectedPadding = errors.New("unexpected padding")
+
+// PaddingMode selects which filler bytes may occur before, between and
+// after data objects (ISO/IEC 7816-4, 5.2.2).
+type PaddingMode int
+
+const (
+	// PaddingZero skips 00 bytes. It is the default.
+	PaddingZero PaddingMode = iota
+	// PaddingFF skips FF bytes and rejects 00 bytes.
+	PaddingFF
+	// PaddingZeroAndFF skips both 00 and FF bytes.
+	PaddingZeroAndFF
+	// PaddingNone rejects 00 bytes.
+	PaddingNone
+)
+
+func (m PaddingMode) String() string {
+	switch m {
+	case PaddingZero:
+		return "zero"
+	case PaddingFF:
+		return "FF"
+	case PaddingZeroAndFF:
+		return "zero and FF"
+	case PaddingNone:
+		return "none"
+	default:
+		return fmt.Sprintf("PaddingMode(%d)", int(m))
+	}
+}
+
+// isPadding reports whether b is a filler byte instead of the first byte of
+// a tag. 00 is always treated as padding, as tag 00 is reserved. FF starts
+// a private constructed tag unless FF padding is enabled.
+func (o DecodeOptions) isPadding(b byte) bool {
+	if b == 0xFF {
+		return o.Padding == PaddingFF || o.Padding == PaddingZeroAndFF
+	}
+
+	return b == 0x00
+}
+
+// checkPadding reports whether the padding byte b is allowed.
+func (o DecodeOptions) checkPadding(b byte) error {
+	if o.DER {
+		return fmt.Errorf("%w: padding is not allowed", ErrNonCanonical)
+	}
+
+	if b == 0x00 && (o.Padding == PaddingFF || o.Padding == PaddingNone) {
+		return fmt.Errorf("%w: %02X padding is not allowed", ErrUnexpectedPadding, b)
+	}
+
+	return nil
+}
+
+// reportPadding passes the padding in input[offset:end] to OnPadding.
+func (o DecodeOptions) reportPadding(offset, end int) {
+	if o.OnPadding != nil && offset >= 0 && offset < end {
+		o.OnPadding(offset, end-offset)
+	}
+}
@@ -0,0 +1,101 @@
+package bertlv_test
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/moov-io/bertlv"
+	"github.com/stretchr/testify/require"
+)
+
+type paddingRun struct {
+	offset, length int
+}
+
+func TestDecodePaddingFF(t *testing.T) {
+	// a record padded to its block size with FF
+	data, err := hex.DecodeString("7007" + "5A0111" + "FF" + "8401AA" + "FFFFFF")
+	require.NoError(t, err)
+
+	_, err = bertlv.Decode(data)
+	require.Error(t, err)
+
+	expected := []bertlv.TLV{
+		bertlv.NewComposite("70",
+			bertlv.NewTag("5A", []byte{0x11}),
+			bertlv.NewTag("84", []byte{0xAA}),
+		),
+	}
+
+	for _, mode := range []bertlv.PaddingMode{bertlv.PaddingFF, bertlv.PaddingZeroAndFF} {
+		t.Run(mode.String(), func(t *testing.T) {
+			var runs []paddingRun
+			opts := bertlv.DecodeOptions{
+				Padding: mode,
+				OnPadding: func(offset, length int) {
+					runs = append(runs, paddingRun{offset, length})
+				},
+			}
+
+			decoded, err := bertlv.DecodeWithOptions(data, opts)
+			require.NoError(t, err)
+			require.Equal(t, expected, decoded)
+			require.Equal(t, []paddingRun{{5, 1}, {9, 3}}, runs)
+
+			// the streaming decoder skips and reports the same padding
+			runs = nil
+			dec := bertlv.NewDecoderWithOptions(bytes.NewReader(data), opts)
+
+			var streamed []bertlv.TLV
+			for {
+				tlv, err := dec.Next()
+				if errors.Is(err, io.EOF) {
+					break
+				}
+				require.NoError(t, err)
+				streamed = append(streamed, tlv)
+			}
+			require.Equal(t, expected, streamed)
+			require.Equal(t, []paddingRun{{5, 1}, {9, 3}}, runs)
+		})
+	}
+}
+
+func TestDecodePaddingModes(t *testing.T) {
+	data, err := hex.DecodeString("00" + "5A0111" + "00FF00")
+	require.NoError(t, err)
+
+	tests := []struct {
+		mode bertlv.PaddingMode
+		err  error
+		runs []paddingRun
+	}{
+		{mode: bertlv.PaddingZero, err: bertlv.ErrTruncated, runs: []paddingRun{{0, 1}}},
+		{mode: bertlv.PaddingFF, err: bertlv.ErrUnexpectedPadding},
+		{mode: bertlv.PaddingZeroAndFF, runs: []paddingRun{{0, 1}, {4, 3}}},
+		{mode: bertlv.PaddingNone, err: bertlv.ErrUnexpectedPadding},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mode.String(), func(t *testing.T) {
+			var runs []paddingRun
+			decoded, err := bertlv.DecodeWithOptions(data, bertlv.DecodeOptions{
+				Padding: tt.mode,
+				OnPadding: func(offset, length int) {
+					runs = append(runs, paddingRun{offset, length})
+				},
+			})
+
+			if tt.err != nil {
+				require.ErrorIs(t, err, tt.err)
+			} else {
+				require.NoError(t, err)
+				require.Equal(t, []bertlv.TLV{bertlv.NewTag("5A", []byte{0x11})}, decoded)
+			}
+			require.Equal(t, tt.runs, runs)
+		})
+	}
+}
@@ -0,0 +1,290 @@
+package bertlv
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidQuery is returned by CompileQuery when a query is malformed.
+var ErrInvalidQuery = errors.New("invalid query")
+
+// Query is a compiled path query over TLV trees. A query is a dotted list
+// of steps, each selecting among the children of the TLVs selected by the
+// previous step:
+//
+//   - a tag, e.g. "A5", selects the children with that tag;
+//   - "*" selects all children;
+//   - "**" selects the TLVs themselves and all their descendants, so
+//     "**.9F10" finds tag 9F10 at any depth.
+//
+// Tag and "*" steps can be followed by predicates in brackets, applied in
+// order to the children selected under each parent:
+//
+//   - [n] keeps the n-th (0-based) of them, e.g. "70[1].57";
+//   - [?TAG=HEX] keeps those with a direct child TAG whose value is HEX,
+//     e.g. "BF0C.61[?4F=A0000000041010].50".
+//
+// A Query is safe for concurrent use.
+type Query struct {
+	expr  string
+	steps []queryStep
+}
+
+type queryStep struct {
+	// tag is a normalized tag, "*" or "**".
+	tag        string
+	predicates []queryPredicate
+}
+
+type queryPredicate struct {
+	// index is the position to keep, or -1 for a filter on tag and value.
+	index int
+	tag   string
+	value []byte
+}
+
+// queryNode is a TLV selected while evaluating a query. The root, whose
+// children are the top level TLVs, has a nil tlv.
+type queryNode struct {
+	tlv  *TLV
+	path Path
+	// index holds the positions of the TLV and its ancestors among their
+	// siblings; comparing them gives the document order.
+	index []int
+}
+
+// CompileQuery parses a query. Tags are normalized with NormalizeTag.
+func CompileQuery(expr string) (*Query, error) {
+	if expr == "" {
+		return nil, fmt.Errorf("%w: empty query", ErrInvalidQuery)
+	}
+
+	q := &Query{expr: expr}
+
+	for _, segment := range strings.Split(expr, ".") {
+		step, err := parseQueryStep(segment)
+		if err != nil {
+			return nil, fmt.Errorf("%w %q: step %q: %w", ErrInvalidQuery, expr, segment, err)
+		}
+
+		// "**.**" selects the same TLVs as "**"
+		if step.tag == "**" && len(q.steps) > 0 && q.steps[len(q.steps)-1].tag == "**" {
+			continue
+		}
+
+		q.steps = append(q.steps, step)
+	}
+
+	return q, nil
+}
+
+// MustCompileQuery is like CompileQuery but panics if the query is
+// malformed.
+func MustCompileQuery(expr string) *Query {
+	q, err := CompileQuery(expr)
+	if err != nil {
+		panic(err)
+	}
+
+	return q
+}
+
+// String returns the source of the query.
+func (q *Query) String() string {
+	return q.expr
+}
+
+// Find returns all TLVs matching the query in document order, together
+// with their normalized paths.
+func (q *Query) Find(tlvs []TLV) []TagMatch {
+	nodes := []queryNode{{}}
+
+	for _, step := range q.steps {
+		var next []queryNode
+
+		for _, node := range nodes {
+			if step.tag == "**" {
+				next = appendDescendants(next, node, tlvs)
+			} else {
+				next = step.appendMatches(next, node, tlvs)
+			}
+		}
+
+		// descendants of nested matches are selected more than once
+		if step.tag == "**" {
+			slices.SortFunc(next, compareQueryNodes)
+			next = slices.CompactFunc(next, func(a, b queryNode) bool {
+				return compareQueryNodes(a, b) == 0
+			})
+		}
+
+		nodes = next
+	}
+
+	slices.SortFunc(nodes, compareQueryNodes)
+
+	var matches []TagMatch
+	for _, node := range nodes {
+		if node.tlv != nil {
+			matches = append(matches, TagMatch{Path: node.path, TLV: *node.tlv})
+		}
+	}
+
+	return matches
+}
+
+// First returns the first TLV matching the query in document order.
+func (q *Query) First(tlvs []TLV) (TLV, bool) {
+	matches := q.Find(tlvs)
+	if len(matches) == 0 {
+		return TLV{}, false
+	}
+
+	return matches[0].TLV, true
+}
+
+func parseQueryStep(segment string) (queryStep, error) {
+	name, predicates := segment, ""
+	if i := strings.IndexByte(segment, '['); i >= 0 {
+		name, predicates = segment[:i], segment[i:]
+	}
+
+	step := queryStep{tag: name}
+
+	switch name {
+	case "*":
+	case "**":
+		if predicates != "" {
+			return queryStep{}, errors.New("** cannot have predicates")
+		}
+	default:
+		tag, err := NormalizeTag(name)
+		if err != nil {
+			return queryStep{}, err
+		}
+		step.tag = tag
+	}
+
+	for predicates != "" {
+		end := strings.IndexByte(predicates, ']')
+		if predicates[0] != '[' || end < 0 {
+			return queryStep{}, fmt.Errorf("malformed predicate %q", predicates)
+		}
+
+		p, err := parseQueryPredicate(predicates[1:end])
+		if err != nil {
+			return queryStep{}, err
+		}
+
+		step.predicates = append(step.predicates, p)
+		predicates = predicates[end+1:]
+	}
+
+	return step, nil
+}
+
+func parseQueryPredicate(s string) (queryPredicate, error) {
+	filter, ok := strings.CutPrefix(s, "?")
+	if !ok {
+		index, err := strconv.Atoi(s)
+		if err != nil || index < 0 {
+			return queryPredicate{}, fmt.Errorf("index %q is not a non-negative integer", s)
+		}
+
+		return queryPredicate{index: index}, nil
+	}
+
+	tag, value, ok := strings.Cut(filter, "=")
+	if !ok {
+		return queryPredicate{}, fmt.Errorf("filter %q must have the form ?TAG=HEX", s)
+	}
+
+	tag, err := NormalizeTag(tag)
+	if err != nil {
+		return queryPredicate{}, err
+	}
+
+	p := queryPredicate{index: -1, tag: tag}
+	if p.value, err = hex.DecodeString(value); err != nil {
+		return queryPredicate{}, fmt.Errorf("filter value %q: %w", value, err)
+	}
+
+	return p, nil
+}
+
+// appendMatches appends the children of node selected by the step.
+func (step *queryStep) appendMatches(dst []queryNode, node queryNode, tlvs []TLV) []queryNode {
+	children := node.children(tlvs)
+	start := len(dst)
+
+	for i := range children {
+		if step.tag == "*" || sameTag(children[i].Tag, step.tag) {
+			dst = append(dst, node.child(children, i))
+		}
+	}
+
+	matched := dst[start:]
+	for _, p := range step.predicates {
+		matched = p.apply(matched)
+	}
+
+	return dst[:start+len(matched)]
+}
+
+// apply filters nodes in place.
+func (p *queryPredicate) apply(nodes []queryNode) []queryNode {
+	if p.index >= 0 {
+		if p.index >= len(nodes) {
+			return nodes[:0]
+		}
+
+		nodes[0] = nodes[p.index]
+		return nodes[:1]
+	}
+
+	return slices.DeleteFunc(nodes, func(node queryNode) bool {
+		return !slices.ContainsFunc(node.tlv.TLVs, func(child TLV) bool {
+			return sameTag(child.Tag, p.tag) && bytes.Equal(child.Value, p.value)
+		})
+	})
+}
+
+// appendDescendants appends node and all its descendants in document
+// order.
+func appendDescendants(dst []queryNode, node queryNode, tlvs []TLV) []queryNode {
+	dst = append(dst, node)
+
+	children := node.children(tlvs)
+	for i := range children {
+		dst = appendDescendants(dst, node.child(children, i), tlvs)
+	}
+
+	return dst
+}
+
+func (node queryNode) children(tlvs []TLV) []TLV {
+	if node.tlv == nil {
+		return tlvs
+	}
+
+	return node.tlv.TLVs
+}
+
+// child returns the node of children[i]. Paths are clipped so that
+// siblings do not share their backing arrays.
+func (node queryNode) child(children []TLV, i int) queryNode {
+	return queryNode{
+		tlv:   &children[i],
+		path:  append(slices.Clip(node.path), normalizeTag(children[i].Tag)),
+		index: append(slices.Clip(node.index), i),
+	}
+}
+
+func compareQueryNodes(a, b queryNode) int {
+	return slices.Compare(a.index, b.index)
+}
@@ -0,0 +1,96 @@
+package bertlv_test
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/moov-io/bertlv"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQuery(t *testing.T) {
+	tests := []struct {
+		query string
+		paths []string
+	}{
+		{"6F.84", []string{"6F.84"}},
+		{"6F.A5.BF0C.61.50", []string{"6F.A5.BF0C.61.50", "6F.A5.BF0C.61.50"}},
+		{"6F.A5.*.61", []string{"6F.A5.BF0C.61", "6F.A5.BF0C.61"}},
+		{"*", []string{"6F", "70", "70", "9F10"}},
+		{"70[1].57", []string{"70.57"}},
+		{"70[2]", nil},
+		{"6F.A5.BF0C.*[1].50", []string{"6F.A5.BF0C.61.50"}},
+		{"**.9F10", []string{"70.77.9F10", "9F10"}},
+		{"**.**.9F10", []string{"70.77.9F10", "9F10"}},
+		{"70.**", []string{"70", "70.57", "70", "70.57", "70.77", "70.77.9F10"}},
+		{"**.61[?4F=A0000000041010].50", []string{"6F.A5.BF0C.61.50"}},
+		{"6F.A5.BF0C.61[?4f=a0000000031010][0].50", []string{"6F.A5.BF0C.61.50"}},
+		{"6F.A5.BF0C.61[?4F=A0].50", nil},
+		{"DF01", nil},
+	}
+
+	tlvs := testTLVs()
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			q, err := bertlv.CompileQuery(tt.query)
+			require.NoError(t, err)
+			require.Equal(t, tt.query, q.String())
+
+			var paths []string
+			for _, match := range q.Find(tlvs) {
+				require.Equal(t, match.TLV.Tag, match.Path[len(match.Path)-1])
+				paths = append(paths, match.Path.String())
+			}
+
+			require.Equal(t, tt.paths, paths)
+		})
+	}
+}
+
+func TestQueryValues(t *testing.T) {
+	tlvs := testTLVs()
+
+	tlv, found := bertlv.MustCompileQuery("BF0C.61[?4F=A0000000041010].50").First(tlvs[0].TLVs[1].TLVs)
+	require.True(t, found)
+	require.Equal(t, []byte("MASTERCARD"), tlv.Value)
+
+	tlv, found = bertlv.MustCompileQuery("70[1].57").First(tlvs)
+	require.True(t, found)
+	require.Equal(t, []byte{0x02}, tlv.Value)
+
+	var values []string
+	for _, match := range bertlv.MustCompileQuery("**.9F10").Find(tlvs) {
+		values = append(values, hex.EncodeToString(match.TLV.Value))
+	}
+	require.Equal(t, []string{"03", "04"}, values)
+
+	_, found = bertlv.MustCompileQuery("DF01").First(tlvs)
+	require.False(t, found)
+}
+
+func TestCompileQueryErrors(t *testing.T) {
+	for _, query := range []string{
+		"",
+		"6F..84",
+		"6F.XYZ",
+		"**[0]",
+		"70[",
+		"70[1",
+		"70[1]x",
+		"70[-1]",
+		"70[a]",
+		"61[?4F]",
+		"61[?4F=ABC]",
+		"61[?ZZ=A0]",
+	} {
+		t.Run(query, func(t *testing.T) {
+			_, err := bertlv.CompileQuery(query)
+			require.ErrorIs(t, err, bertlv.ErrInvalidQuery)
+		})
+	}
+
+	require.Panics(t, func() {
+		bertlv.MustCompileQuery("70[")
+	})
+}
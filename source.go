@@ -0,0 +1,61 @@
+package bertlv
+
+import "slices"
+
+// Source describes where a decoded TLV was found in the input and how it
+// was encoded there. It is only set when decoding with
+// DecodeOptions.KeepSource. The byte slices alias the input.
+type Source struct {
+	// Offset is the absolute offset of the first tag byte in the input.
+	Offset int
+	// HeaderLength is the number of tag and length bytes.
+	HeaderLength int
+	// Length holds the length bytes as they appeared in the input.
+	Length []byte
+	// Raw is the complete encoding of the TLV: tag, length, value and, for
+	// the indefinite length form, the end-of-contents marker.
+	Raw []byte
+	// Padding holds the padding bytes that directly preceded the TLV.
+	Padding []byte
+	// TrailingPadding holds the padding bytes that followed the TLV when
+	// it was the last one of its constructed value or of the input.
+	TrailingPadding []byte
+	// ContentPadding holds the padding bytes that made up the whole value
+	// of a constructed TLV without children.
+	ContentPadding []byte
+}
+
+// newSource returns the Source of the TLV encoded in data[start:end] whose
+// length bytes are data[lengthStart:valueStart].
+func newSource(data []byte, base, start, lengthStart, valueStart, end int) *Source {
+	return &Source{
+		Offset:       base + start,
+		HeaderLength: valueStart - start,
+		Length:       data[lengthStart:valueStart],
+		Raw:          data[start:end],
+	}
+}
+
+// clone returns a deep copy of s that no longer aliases the input.
+func (s *Source) clone() *Source {
+	if s == nil {
+		return nil
+	}
+
+	return &Source{
+		Offset:          s.Offset,
+		HeaderLength:    s.HeaderLength,
+		Length:          slices.Clone(s.Length),
+		Raw:             slices.Clone(s.Raw),
+		Padding:         slices.Clone(s.Padding),
+		TrailingPadding: slices.Clone(s.TrailingPadding),
+		ContentPadding:  slices.Clone(s.ContentPadding),
+	}
+}
+
+// keepsLength reports whether the original length bytes encode length.
+func (s *Source) keepsLength(length int) bool {
+	original, read, err := decodeLength(s.Length)
+
+	return err == nil && read == len(s.Length) && original == length
+}
@@ -0,0 +1,200 @@
+package bertlv_test
+
+import (
+	"encoding/hex"
+	"fmt"
+	"testing"
+
+	"github.com/moov-io/bertlv"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodeKeepSource(t *testing.T) {
+	// 9F10 uses the long form length for a short value, 30 the indefinite form
+	data, err := hex.DecodeString("00" + "770A" + "9F10810311223300" + "5A00" + "3080" + "020101" + "0000")
+	require.NoError(t, err)
+
+	tlvs, err := bertlv.DecodeWithOptions(data, bertlv.DecodeOptions{KeepSource: true})
+	require.NoError(t, err)
+	require.Len(t, tlvs, 2)
+
+	tmpl := tlvs[0]
+	require.Equal(t, &bertlv.Source{
+		Offset:       1,
+		HeaderLength: 2,
+		Length:       []byte{0x0A},
+		Raw:          data[1:13],
+		Padding:      []byte{0x00},
+	}, tmpl.Source)
+
+	require.Equal(t, &bertlv.Source{
+		Offset:       3,
+		HeaderLength: 4,
+		Length:       []byte{0x81, 0x03},
+		Raw:          []byte{0x9F, 0x10, 0x81, 0x03, 0x11, 0x22, 0x33},
+	}, tmpl.TLVs[0].Source)
+
+	require.Equal(t, &bertlv.Source{
+		Offset:       11,
+		HeaderLength: 2,
+		Length:       []byte{0x00},
+		Raw:          []byte{0x5A, 0x00},
+		Padding:      []byte{0x00},
+	}, tmpl.TLVs[1].Source)
+
+	seq := tlvs[1]
+	require.Equal(t, &bertlv.Source{
+		Offset:       13,
+		HeaderLength: 2,
+		Length:       []byte{0x80},
+		Raw:          data[13:],
+	}, seq.Source)
+	require.Equal(t, 15, seq.TLVs[0].Source.Offset)
+
+	// without the option no source is recorded
+	tlvs, err = bertlv.Decode(data)
+	require.NoError(t, err)
+	require.Nil(t, tlvs[0].Source)
+	require.Nil(t, tlvs[0].TLVs[0].Source)
+}
+
+func TestDecodeLenientKeepSource(t *testing.T) {
+	data, err := hex.DecodeString("5701AA" + "5A0511")
+	require.NoError(t, err)
+
+	tlvs, problems := bertlv.DecodeLenient(data, bertlv.DecodeOptions{KeepRemainder: true, KeepSource: true})
+	require.Len(t, problems, 1)
+	require.Len(t, tlvs, 2)
+	require.Equal(t, &bertlv.Source{Offset: 3, Raw: []byte{0x5A, 0x05, 0x11}}, tlvs[1].Source)
+}
+
+func TestCopyTagsKeepsSource(t *testing.T) {
+	data, err := hex.DecodeString("7005" + "9F10810111")
+	require.NoError(t, err)
+
+	tlvs, err := bertlv.DecodeWithOptions(data, bertlv.DecodeOptions{KeepSource: true})
+	require.NoError(t, err)
+
+	copied := bertlv.CopyTags(tlvs, "70")
+	require.Equal(t, tlvs, copied)
+
+	// the copy does not alias the input
+	data[3] = 0xFF
+	require.Equal(t, []byte{0x9F, 0x10, 0x81, 0x01, 0x11}, copied[0].TLVs[0].Source.Raw)
+	require.Equal(t, []byte{0x81, 0x01}, copied[0].TLVs[0].Source.Length)
+}
+
+func TestCloneSource(t *testing.T) {
+	// a Source built by hand need not slice its Length out of Raw
+	tlv := bertlv.TLV{Tag: "9F10", Source: &bertlv.Source{Length: []byte{0x81, 0x01}}}
+
+	clone := tlv.Clone()
+	require.Equal(t, tlv, clone)
+
+	tlv.Source.Length[1] = 0x02
+	require.Equal(t, []byte{0x81, 0x01}, clone.Source.Length)
+
+	require.Equal(t, []bertlv.TLV{clone}, bertlv.CopyTags([]bertlv.TLV{clone}, "9F10"))
+}
+
+func TestEncodePreserve(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{name: "long form length", data: "9F10810711223344556677"},
+		{name: "redundant length bytes", data: "70075A820003111111" + "9F36020001"},
+		{name: "padding", data: "0000" + "700A" + "00" + "5A0111" + "00" + "9F3602AABB" + "00" + "0000" + "8401FF" + "000000"},
+		{name: "trailing padding in constructed", data: "7005" + "5A0111" + "0000" + "8401FF"},
+		{name: "indefinite length", data: "3080" + "00" + "02810101" + "00" + "0000" + "00"},
+		{name: "padding only value", data: "7001" + "00"},
+		{name: "padding only indefinite value", data: "3080" + "00" + "0000"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := hex.DecodeString(tt.data)
+			require.NoError(t, err)
+
+			tlvs, err := bertlv.DecodeWithOptions(data, bertlv.DecodeOptions{KeepSource: true})
+			require.NoError(t, err)
+
+			encoded, err := bertlv.EncodeWithOptions(tlvs, bertlv.EncodeOptions{Preserve: true})
+			require.NoError(t, err)
+			require.Equal(t, data, encoded)
+
+			// a plain Encode normalizes the encoding
+			encoded, err = bertlv.Encode(tlvs)
+			require.NoError(t, err)
+			require.NotEqual(t, data, encoded)
+		})
+	}
+
+	t.Run("modified value", func(t *testing.T) {
+		data, err := hex.DecodeString("770A" + "9F10810311223300" + "5A00")
+		require.NoError(t, err)
+
+		tlvs, err := bertlv.DecodeWithOptions(data, bertlv.DecodeOptions{KeepSource: true})
+		require.NoError(t, err)
+
+		// same length: the original length form is kept
+		tlvs[0].TLVs[0].Value = []byte{0xAA, 0xBB, 0xCC}
+		encoded, err := bertlv.EncodeWithOptions(tlvs, bertlv.EncodeOptions{Preserve: true})
+		require.NoError(t, err)
+		require.Equal(t, "770A"+"9F108103AABBCC00"+"5A00", fmt.Sprintf("%X", encoded))
+
+		// different length: the length is encoded again
+		tlvs[0].TLVs[0].Value = []byte{0xAA}
+		encoded, err = bertlv.EncodeWithOptions(tlvs, bertlv.EncodeOptions{Preserve: true})
+		require.NoError(t, err)
+		require.Equal(t, "7707"+"9F1001AA00"+"5A00", fmt.Sprintf("%X", encoded))
+	})
+
+	t.Run("lazy padding only value", func(t *testing.T) {
+		data := []byte{0x70, 0x01, 0x00}
+
+		tlvs, err := bertlv.DecodeWithOptions(data, bertlv.DecodeOptions{KeepSource: true, Lazy: true})
+		require.NoError(t, err)
+
+		children, err := tlvs[0].Children()
+		require.NoError(t, err)
+		require.Empty(t, children)
+
+		encoded, err := bertlv.EncodeWithOptions(tlvs, bertlv.EncodeOptions{Preserve: true})
+		require.NoError(t, err)
+		require.Equal(t, data, encoded)
+	})
+
+	t.Run("padding only input", func(t *testing.T) {
+		var padding [][2]int
+
+		// there is no TLV to keep the padding in
+		tlvs, err := bertlv.DecodeWithOptions([]byte{0x00, 0x00}, bertlv.DecodeOptions{
+			KeepSource: true,
+			OnPadding: func(offset, length int) {
+				padding = append(padding, [2]int{offset, length})
+			},
+		})
+		require.NoError(t, err)
+		require.Empty(t, tlvs)
+		require.Equal(t, [][2]int{{0, 2}}, padding)
+	})
+
+	t.Run("padding before remainder", func(t *testing.T) {
+		data, err := hex.DecodeString("3000" + "00000000" + "30")
+		require.NoError(t, err)
+
+		tlvs, problems := bertlv.DecodeLenient(data, bertlv.DecodeOptions{KeepSource: true, KeepRemainder: true})
+		require.Len(t, problems, 1)
+		require.Equal(t, []byte{0x00, 0x00, 0x00, 0x00}, tlvs[1].Source.Padding)
+
+		encoded, err := bertlv.EncodeWithOptions(tlvs, bertlv.EncodeOptions{Preserve: true})
+		require.NoError(t, err)
+		require.Equal(t, data, encoded)
+	})
+
+	t.Run("DER", func(t *testing.T) {
+		_, err := bertlv.EncodeWithOptions(nil, bertlv.EncodeOptions{Preserve: true, DER: true})
+		require.Error(t, err)
+	})
+}
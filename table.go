@@ -0,0 +1,245 @@
+package bertlv
+
+import (
+	"fmt"
+)
+
+// Node is a decoded data object in a NodeTable. Nodes reference the decoded
+// input by offset and link to each other by index; -1 means no node.
+type Node struct {
+	Tag Tag
+	// Offset is the offset of the first tag byte in the input.
+	Offset int
+	// HeaderLength is the number of tag and length bytes.
+	HeaderLength int
+	// ValueLength is the length of the value. For the indefinite length
+	// form it excludes the end-of-contents marker.
+	ValueLength int
+
+	Parent      int
+	FirstChild  int
+	NextSibling int
+
+	Constructed bool
+	Indefinite  bool
+}
+
+// NodeTable is a flat representation of decoded BER-TLV data. Nodes are
+// stored in depth-first order and their values are slices of the input,
+// so decoding allocates nothing once the table has grown to the size of
+// the input. TLV values are only materialized on demand.
+type NodeTable struct {
+	data  []byte
+	Nodes []Node
+}
+
+// DecodeTable decodes data into a new NodeTable.
+func DecodeTable(data []byte) (*NodeTable, error) {
+	t := &NodeTable{}
+	if err := t.Reset(data); err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+// Reset decodes data into the table, reusing the storage of the previous
+// nodes. The table keeps a reference to data.
+func (t *NodeTable) Reset(data []byte) error {
+	t.data = data
+	t.Nodes = t.Nodes[:0]
+
+	if _, err := t.decode(0, len(data), -1, false); err != nil {
+		t.data = nil
+		t.Nodes = t.Nodes[:0]
+
+		return err
+	}
+
+	return nil
+}
+
+// decode appends the nodes of the data objects in data[start:end] as
+// children of parent. When indefinite is set, it stops at the
+// end-of-contents marker. It returns the offset after the last byte read.
+func (t *NodeTable) decode(start, end, parent int, indefinite bool) (int, error) {
+	prev := -1
+
+	pos := start
+	for pos < end {
+		if indefinite && isEndOfContents(t.data[pos:end]) {
+			return pos + len(endOfContents), nil
+		}
+
+		// read the tag
+		tagOffset := pos
+		tag, read, err := decodeTag(t.data[pos:end])
+		if err != nil {
+			return 0, t.error(tagOffset, parent, nil, StageTag, err)
+		}
+		pos += read
+
+		// '00' bytes may occur between TLV-coded data objects. Ignore them.
+		if tag[0] == 0x00 {
+			continue
+		}
+
+		if len(tag) > maxTagLength {
+			return 0, t.error(tagOffset, parent, nil, StageTag, fmt.Errorf("%w: tags longer than %d bytes are not supported", ErrInvalidTag, maxTagLength))
+		}
+
+		// read the length
+		lengthOffset := pos
+		length, read, err := decodeLength(t.data[pos:end])
+		if err != nil {
+			return 0, t.error(lengthOffset, parent, tag, StageLength, err)
+		}
+		pos += read
+
+		constructed := isConstructed(tag)
+
+		if length == indefiniteLength && !constructed {
+			return 0, t.error(lengthOffset, parent, tag, StageLength, fmt.Errorf("%w: indefinite length is not allowed for primitive tag", ErrInvalidLength))
+		}
+
+		if length != indefiniteLength && (length < 0 || end-pos < length) {
+			return 0, t.error(pos, parent, tag, StageValue, fmt.Errorf("%w: insufficient data for expected length %d", ErrTruncated, length))
+		}
+
+		index := len(t.Nodes)
+		t.Nodes = append(t.Nodes, Node{
+			Tag:          tagFromBytes(tag),
+			Offset:       tagOffset,
+			HeaderLength: pos - tagOffset,
+			ValueLength:  length,
+			Parent:       parent,
+			FirstChild:   -1,
+			NextSibling:  -1,
+			Constructed:  constructed,
+			Indefinite:   length == indefiniteLength,
+		})
+
+		if prev >= 0 {
+			t.Nodes[prev].NextSibling = index
+		} else if parent >= 0 {
+			t.Nodes[parent].FirstChild = index
+		}
+		prev = index
+
+		switch {
+		case length == indefiniteLength:
+			next, err := t.decode(pos, end, index, true)
+			if err != nil {
+				return 0, err
+			}
+			t.Nodes[index].ValueLength = next - pos - len(endOfContents)
+			pos = next
+		case constructed:
+			if _, err := t.decode(pos, pos+length, index, false); err != nil {
+				return 0, err
+			}
+			pos += length
+		default:
+			pos += length
+		}
+	}
+
+	if indefinite {
+		return 0, t.error(pos, parent, nil, StageValue, fmt.Errorf("%w: end-of-contents is missing for indefinite length", ErrTruncated))
+	}
+
+	return pos, nil
+}
+
+// error returns a DecodeError for the data object with the given tag inside
+// parent. A nil tag refers to parent itself.
+func (t *NodeTable) error(offset, parent int, tag []byte, stage DecodeStage, err error) error {
+	var path []string
+	for i := parent; i >= 0; i = t.Nodes[i].Parent {
+		path = append(path, tagString(t.tagBytes(i)))
+	}
+	for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+		path[i], path[j] = path[j], path[i]
+	}
+	if tag != nil {
+		path = append(path, tagString(tag))
+	}
+
+	return newDecodeError(offset, path, stage, err)
+}
+
+// Data returns the decoded input.
+func (t *NodeTable) Data() []byte {
+	return t.data
+}
+
+// Value returns the value of node i. For constructed nodes it holds the
+// encoded children.
+func (t *NodeTable) Value(i int) []byte {
+	n := &t.Nodes[i]
+	start := n.Offset + n.HeaderLength
+
+	return t.data[start : start+n.ValueLength : start+n.ValueLength]
+}
+
+// Raw returns the complete encoding of node i.
+func (t *NodeTable) Raw(i int) []byte {
+	n := &t.Nodes[i]
+	end := n.Offset + n.HeaderLength + n.ValueLength
+	if n.Indefinite {
+		end += len(endOfContents)
+	}
+
+	return t.data[n.Offset:end:end]
+}
+
+// TagString returns the hex encoded tag of node i, as used by TLV.Tag.
+func (t *NodeTable) TagString(i int) string {
+	return tagString(t.tagBytes(i))
+}
+
+func (t *NodeTable) tagBytes(i int) []byte {
+	n := &t.Nodes[i]
+
+	return t.data[n.Offset : n.Offset+n.Tag.Len()]
+}
+
+// Find returns the index of the first node with the given tag in
+// depth-first order, or -1.
+func (t *NodeTable) Find(tag Tag) int {
+	for i := range t.Nodes {
+		if t.Nodes[i].Tag == tag {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// TLV materializes node i and its children. Values alias the input.
+func (t *NodeTable) TLV(i int) TLV {
+	n := &t.Nodes[i]
+
+	tlv := TLV{Tag: t.TagString(i), Indefinite: n.Indefinite}
+	if !n.Constructed {
+		tlv.Value = t.Value(i)
+
+		return tlv
+	}
+
+	for c := n.FirstChild; c >= 0; c = t.Nodes[c].NextSibling {
+		tlv.TLVs = append(tlv.TLVs, t.TLV(c))
+	}
+
+	return tlv
+}
+
+// TLVs materializes all top level nodes, as Decode would return them.
+func (t *NodeTable) TLVs() []TLV {
+	var tlvs []TLV
+	for i := 0; i >= 0 && i < len(t.Nodes); i = t.Nodes[i].NextSibling {
+		tlvs = append(tlvs, t.TLV(i))
+	}
+
+	return tlvs
+}
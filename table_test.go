@@ -0,0 +1,157 @@
+package bertlv_test
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/moov-io/bertlv"
+	"github.com/stretchr/testify/require"
+)
+
+// fciData is an EMV SELECT response with nested templates and padding.
+const fciData = "6F2F840E325041592E5359532E4444463031A51DBF0C1A61184F07A0000000041010500A4D617374657263617264870101" + "00" + "9F02060000000012345A0841111111111111116100"
+
+func TestDecodeTable(t *testing.T) {
+	data, err := hex.DecodeString(fciData)
+	require.NoError(t, err)
+
+	expected, err := bertlv.Decode(data)
+	require.NoError(t, err)
+
+	table, err := bertlv.DecodeTable(data)
+	require.NoError(t, err)
+
+	require.Equal(t, expected, table.TLVs())
+
+	// 6F > 84, A5 > BF0C > 61 > 4F, 50, 87
+	require.Len(t, table.Nodes, 11)
+
+	root := table.Nodes[0]
+	require.Equal(t, bertlv.Tag(0x6F), root.Tag)
+	require.Equal(t, -1, root.Parent)
+	require.Equal(t, 1, root.FirstChild)
+	require.Equal(t, 8, root.NextSibling)
+	require.True(t, root.Constructed)
+
+	i := table.Find(0x9F02)
+	require.Equal(t, 8, i)
+	require.Equal(t, "9F02", table.TagString(i))
+	require.Equal(t, []byte{0x00, 0x00, 0x00, 0x00, 0x12, 0x34}, table.Value(i))
+	require.Equal(t, data[50:59], table.Raw(i))
+
+	i = table.Find(0x50)
+	require.Equal(t, []byte("Mastercard"), table.Value(i))
+	require.Equal(t, "BF0C", table.TagString(table.Nodes[table.Nodes[i].Parent].Parent))
+	require.Equal(t, bertlv.NewTag("87", []byte{0x01}), table.TLV(table.Nodes[i].NextSibling))
+
+	require.Equal(t, -1, table.Find(0x9F10))
+
+	// the values alias the input
+	require.Same(t, &data[len(data)-10], &table.Value(table.Find(0x5A))[0])
+}
+
+func TestDecodeTableIndefiniteLength(t *testing.T) {
+	data, err := hex.DecodeString("3080" + "020101" + "3180" + "0402AABB" + "0000" + "0000" + "5A0111")
+	require.NoError(t, err)
+
+	expected, err := bertlv.Decode(data)
+	require.NoError(t, err)
+
+	table, err := bertlv.DecodeTable(data)
+	require.NoError(t, err)
+
+	require.Equal(t, expected, table.TLVs())
+
+	require.True(t, table.Nodes[0].Indefinite)
+	require.Equal(t, 11, table.Nodes[0].ValueLength)
+	require.Equal(t, data[:15], table.Raw(0))
+	require.Equal(t, data[2:13], table.Value(0))
+}
+
+func TestNodeTableReset(t *testing.T) {
+	data, err := hex.DecodeString(fciData)
+	require.NoError(t, err)
+
+	table := &bertlv.NodeTable{}
+	require.NoError(t, table.Reset(data))
+	require.Len(t, table.Nodes, 11)
+
+	require.NoError(t, table.Reset([]byte{0x5A, 0x01, 0x11}))
+	require.Equal(t, []bertlv.Node{{
+		Tag: 0x5A, Offset: 0, HeaderLength: 2, ValueLength: 1,
+		Parent: -1, FirstChild: -1, NextSibling: -1,
+	}}, table.Nodes)
+
+	allocs := testing.AllocsPerRun(100, func() {
+		_ = table.Reset(data)
+	})
+	require.Zero(t, allocs)
+}
+
+func TestDecodeTableErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		data   string
+		offset int
+		path   string
+		stage  bertlv.DecodeStage
+		err    error
+	}{
+		{name: "incomplete multi-byte tag", data: "9F", offset: 0, stage: bertlv.StageTag, err: bertlv.ErrTruncated},
+		{name: "tag too long for table", data: "9F8181818181818181010100", offset: 0, stage: bertlv.StageTag, err: bertlv.ErrInvalidTag},
+		{name: "missing length", data: "7001" + "5A", offset: 3, path: "70.5A", stage: bertlv.StageLength, err: bertlv.ErrTruncated},
+		{name: "truncated value", data: "70047702" + "5A04", offset: 6, path: "70.77.5A", stage: bertlv.StageValue, err: bertlv.ErrTruncated},
+		{name: "indefinite primitive", data: "5A80", offset: 1, path: "5A", stage: bertlv.StageLength, err: bertlv.ErrInvalidLength},
+		{name: "missing end-of-contents", data: "30805A0111", offset: 5, path: "30", stage: bertlv.StageValue, err: bertlv.ErrTruncated},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := hex.DecodeString(tt.data)
+			require.NoError(t, err)
+
+			_, err = bertlv.DecodeTable(data)
+			requireDecodeError(t, err, tt.offset, tt.path, tt.stage, tt.err)
+		})
+	}
+}
+
+func BenchmarkDecode(b *testing.B) {
+	data, _ := hex.DecodeString(fciData)
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_, _ = bertlv.Decode(data)
+	}
+}
+
+func BenchmarkDecodeTable(b *testing.B) {
+	data, _ := hex.DecodeString(fciData)
+	table := &bertlv.NodeTable{}
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_ = table.Reset(data)
+	}
+}
+
+func BenchmarkDecodeFind(b *testing.B) {
+	data, _ := hex.DecodeString(fciData)
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		tlvs, _ := bertlv.Decode(data)
+		_, _ = bertlv.FindFirstTag(tlvs, "9F02")
+	}
+}
+
+func BenchmarkDecodeTableFind(b *testing.B) {
+	data, _ := hex.DecodeString(fciData)
+	table := &bertlv.NodeTable{}
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_ = table.Reset(data)
+		_ = table.Value(table.Find(0x9F02))
+	}
+}
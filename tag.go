@@ -0,0 +1,224 @@
+package bertlv
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// maxTagLength is the longest tag that can be represented as a Tag.
+const maxTagLength = 8
+
+// Tag is a parsed BER-TLV tag. It holds the tag bytes as a big-endian
+// number, so 9F02 is Tag(0x9F02). Tags are comparable and can be used as
+// map keys.
+type Tag uint64
+
+// Class is the class of a tag, encoded in its two most significant bits.
+type Class byte
+
+const (
+	ClassUniversal Class = iota
+	ClassApplication
+	ClassContextSpecific
+	ClassPrivate
+)
+
+func (c Class) String() string {
+	switch c {
+	case ClassUniversal:
+		return "universal"
+	case ClassApplication:
+		return "application"
+	case ClassContextSpecific:
+		return "context-specific"
+	case ClassPrivate:
+		return "private"
+	default:
+		return fmt.Sprintf("Class(%d)", int(c))
+	}
+}
+
+// ParseTag parses a hex encoded tag such as "9F02", the form used by
+// TLV.Tag. Like NormalizeTag, it accepts lowercase hex and whitespace.
+func ParseTag(s string) (Tag, error) {
+	var buf [maxTagBuffer]byte
+	tag, err := appendTag(buf[:0], s)
+	if err != nil {
+		return 0, err
+	}
+
+	return checkedTag(tag)
+}
+
+// NormalizeTag returns the canonical form of a hex encoded tag: uppercase
+// and without whitespace, so "9f 10" becomes "9F10". It returns an error
+// wrapping ErrInvalidTag if the tag is malformed.
+//
+// The lookups (FindTagByPath, FindFirstTag, FindAllTags, ByTag, CopyTags,
+// FindFirst and Find) normalize their tags the same way, but a malformed
+// tag simply matches nothing. To report it instead, check tags that are
+// not literals with NormalizeTag, or look them up with a Query, since
+// CompileQuery returns an error wrapping ErrInvalidTag.
+func NormalizeTag(tag string) (string, error) {
+	var buf [maxTagBuffer]byte
+	b, err := appendTag(buf[:0], tag)
+	if err != nil {
+		return "", err
+	}
+
+	if isNormalized(tag) {
+		return tag, nil
+	}
+
+	return tagString(b), nil
+}
+
+// normalizeTag returns the canonical form of tag, or tag itself when it is
+// malformed so that it is rejected once it is encoded.
+func normalizeTag(tag string) string {
+	if normalized, err := NormalizeTag(tag); err == nil {
+		return normalized
+	}
+
+	return tag
+}
+
+// isNormalized reports whether tag only consists of uppercase hex digits.
+func isNormalized(tag string) bool {
+	for i := 0; i < len(tag); i++ {
+		c := tag[i]
+		if (c < '0' || c > '9') && (c < 'A' || c > 'F') {
+			return false
+		}
+	}
+
+	return true
+}
+
+// sameTag reports whether the tag of a TLV is the normalized tag.
+func sameTag(tag, normalized string) bool {
+	if tag == normalized {
+		return true
+	}
+
+	// a different tag in canonical form cannot match
+	if isNormalized(tag) {
+		return false
+	}
+
+	n, err := NormalizeTag(tag)
+
+	return err == nil && n == normalized
+}
+
+// stripSpaces removes all whitespace from the tag.
+func stripSpaces(tag string) string {
+	if !strings.ContainsFunc(tag, unicode.IsSpace) {
+		return tag
+	}
+
+	return strings.Join(strings.Fields(tag), "")
+}
+
+// MustParseTag is like ParseTag but panics if the tag is invalid. It is
+// intended for tag constants.
+func MustParseTag(s string) Tag {
+	tag, err := ParseTag(s)
+	if err != nil {
+		panic(err)
+	}
+
+	return tag
+}
+
+// TagFromBytes returns the Tag for the encoded tag bytes.
+func TagFromBytes(b []byte) (Tag, error) {
+	if err := validateTag(b); err != nil {
+		return 0, fmt.Errorf("%w: %w", ErrInvalidTag, err)
+	}
+
+	return checkedTag(b)
+}
+
+func checkedTag(tag []byte) (Tag, error) {
+	if len(tag) > maxTagLength {
+		return 0, fmt.Errorf("%w: tags longer than %d bytes are not supported", ErrInvalidTag, maxTagLength)
+	}
+
+	return tagFromBytes(tag), nil
+}
+
+// tagFromBytes converts tag bytes that are known to be valid.
+func tagFromBytes(tag []byte) Tag {
+	var t Tag
+	for _, b := range tag {
+		t = t<<8 | Tag(b)
+	}
+
+	return t
+}
+
+// first returns the first tag byte, which holds the class, the constructed
+// bit and the short tag number.
+func (t Tag) first() byte {
+	return byte((t >> (8 * (t.Len() - 1))) & 0xFF)
+}
+
+// Class returns the class of the tag.
+func (t Tag) Class() Class {
+	return Class(t.first() >> 6)
+}
+
+// Constructed reports whether the value of the tag consists of nested
+// data objects.
+func (t Tag) Constructed() bool {
+	return t.first()&0b0010_0000 == 0b0010_0000
+}
+
+// Number returns the tag number within its class. For multi-byte tags it
+// is the base-128 number encoded in the subsequent bytes.
+func (t Tag) Number() uint64 {
+	first := t.first()
+	if first&0b0001_1111 != 0b0001_1111 {
+		return uint64(first & 0b0001_1111)
+	}
+
+	var n uint64
+	for i := t.Len() - 2; i >= 0; i-- {
+		n = n<<7 | uint64((t>>(8*i))&0b0111_1111)
+	}
+
+	return n
+}
+
+// Len returns the number of tag bytes.
+func (t Tag) Len() int {
+	length := 1
+	for t > 0xFF {
+		length++
+		t >>= 8
+	}
+
+	return length
+}
+
+// Bytes returns the encoded tag bytes.
+func (t Tag) Bytes() []byte {
+	return t.appendBytes(make([]byte, 0, t.Len()))
+}
+
+func (t Tag) appendBytes(dst []byte) []byte {
+	for i := t.Len() - 1; i >= 0; i-- {
+		dst = append(dst, byte((t>>(8*i))&0xFF))
+	}
+
+	return dst
+}
+
+// String returns the tag in the hex form used by TLV.Tag, e.g. "9F02".
+func (t Tag) String() string {
+	var buf [maxTagLength]byte
+
+	return tagString(t.appendBytes(buf[:0]))
+}
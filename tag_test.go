@@ -0,0 +1,79 @@
+package bertlv_test
+
+import (
+	"testing"
+
+	"github.com/moov-io/bertlv"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTag(t *testing.T) {
+	tests := []struct {
+		tag         string
+		class       bertlv.Class
+		constructed bool
+		number      uint64
+		bytes       []byte
+	}{
+		{tag: "5A", class: bertlv.ClassApplication, number: 0x1A, bytes: []byte{0x5A}},
+		{tag: "6F", class: bertlv.ClassApplication, constructed: true, number: 0x0F, bytes: []byte{0x6F}},
+		{tag: "30", class: bertlv.ClassUniversal, constructed: true, number: 0x10, bytes: []byte{0x30}},
+		{tag: "84", class: bertlv.ClassContextSpecific, number: 4, bytes: []byte{0x84}},
+		{tag: "9F02", class: bertlv.ClassContextSpecific, number: 2, bytes: []byte{0x9F, 0x02}},
+		{tag: "BF0C", class: bertlv.ClassContextSpecific, constructed: true, number: 12, bytes: []byte{0xBF, 0x0C}},
+		{tag: "DF8101", class: bertlv.ClassPrivate, number: 129, bytes: []byte{0xDF, 0x81, 0x01}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.tag, func(t *testing.T) {
+			tag, err := bertlv.ParseTag(tt.tag)
+			require.NoError(t, err)
+
+			require.Equal(t, tt.class, tag.Class())
+			require.Equal(t, tt.constructed, tag.Constructed())
+			require.Equal(t, tt.number, tag.Number())
+			require.Equal(t, tt.bytes, tag.Bytes())
+			require.Equal(t, len(tt.bytes), tag.Len())
+			require.Equal(t, tt.tag, tag.String())
+
+			fromBytes, err := bertlv.TagFromBytes(tt.bytes)
+			require.NoError(t, err)
+			require.Equal(t, tag, fromBytes)
+		})
+	}
+
+	// tags are comparable
+	require.Equal(t, bertlv.Tag(0x9F02), bertlv.MustParseTag("9f02"))
+	require.Equal(t, "context-specific", bertlv.ClassContextSpecific.String())
+}
+
+func TestParseTagErrors(t *testing.T) {
+	for _, tag := range []string{"", "9F", "5A01", "ZZ", "9F818181818181818101"} {
+		_, err := bertlv.ParseTag(tag)
+		require.ErrorIs(t, err, bertlv.ErrInvalidTag, tag)
+	}
+
+	_, err := bertlv.TagFromBytes([]byte{0x9F})
+	require.ErrorIs(t, err, bertlv.ErrInvalidTag)
+
+	require.Panics(t, func() { bertlv.MustParseTag("9F") })
+}
+
+func TestNormalizeTag(t *testing.T) {
+	for tag, expected := range map[string]string{
+		"9F10":     "9F10",
+		"9f10":     "9F10",
+		"9F 10":    "9F10",
+		" bf0c\t":  "BF0C",
+		"df 81 01": "DF8101",
+	} {
+		normalized, err := bertlv.NormalizeTag(tag)
+		require.NoError(t, err, tag)
+		require.Equal(t, expected, normalized, tag)
+	}
+
+	for _, tag := range []string{"", " ", "9F", "9F1", "5A5A", "XY"} {
+		_, err := bertlv.NormalizeTag(tag)
+		require.ErrorIs(t, err, bertlv.ErrInvalidTag, tag)
+	}
+}
@@ -1,6 +1,7 @@
 package bertlv
 
 import (
+	"bytes"
 	"encoding/hex"
 	"errors"
 	"fmt"
@@ -8,123 +9,790 @@ import (
 	"slices"
 	"strconv"
 	"strings"
+	"sync"
 )
 
 type TLV struct {
-	Tag   string
+	Tag string
+	// Value holds the value of a primitive TLV. A constructed TLV without
+	// TLVs is encoded with Value as its already encoded content, as
+	// decoded for DecodeOptions.OpaqueTags or DecodeOptions.Lazy; setting
+	// both is an error. A primitive TLV decoded with
+	// DecodeOptions.NestedTags has both, and Value is what is encoded.
 	Value []byte
 	TLVs  []TLV
+	// Indefinite reports whether the constructed TLV uses the BER
+	// indefinite length form: its children are followed by the
+	// end-of-contents marker (00 00) instead of being preceded by a length.
+	Indefinite bool
+	// Source describes the encoding of a decoded TLV in the input. It is
+	// only set when decoding with DecodeOptions.KeepSource.
+	Source *Source
+	// Raw marks bytes that are not a data object, such as the remainder
+	// kept by DecodeOptions.KeepRemainder. A raw TLV has neither a Tag nor
+	// TLVs, and Encode writes its Value as is.
+	Raw bool
+
+	// lazy is set while the children of a constructed TLV decoded with
+	// DecodeOptions.Lazy are still held in Value.
+	lazy *lazyValue
 }
 
+// lazyValue holds the decoding state needed to decode the children of a
+// lazily decoded TLV on first access.
+type lazyValue struct {
+	opts DecodeOptions
+	path []string
+	base int
+	// budget counts the data objects decoded from the input, including
+	// expanded lazy values, when DecodeOptions.MaxElements is set.
+	budget *elementBudget
+}
+
+// elementBudget is the number of data objects decoded from an input. It is
+// shared by all lazy values of the input, so that MaxElements limits the
+// whole input, as it does when decoding eagerly.
+type elementBudget struct {
+	mu       sync.Mutex
+	elements int
+}
+
+// Children returns the children of the TLV. The children of a constructed
+// TLV decoded with DecodeOptions.Lazy are decoded from Value on the first
+// call, returning the same errors Decode would have returned. Once decoded,
+// they are stored in TLVs and Value is cleared.
+//
+// DecodeOptions.MaxElements limits the data objects of the whole input, so
+// the expansion that exceeds it fails, whichever TLV it is called on.
+// Expansions of TLVs from the same input are serialized then.
+func (tlv *TLV) Children() ([]TLV, error) {
+	if tlv.lazy == nil {
+		return tlv.TLVs, nil
+	}
+
+	d := decodeState{opts: tlv.lazy.opts, path: tlv.lazy.path, budget: tlv.lazy.budget}
+
+	if d.budget != nil {
+		d.budget.mu.Lock()
+		defer d.budget.mu.Unlock()
+
+		d.elements = d.budget.elements
+	}
+
+	tlvs, _, err := d.decodeTLVs(tlv.Value, tlv.lazy.base, false)
+	if err != nil {
+		return nil, err
+	}
+
+	if d.budget != nil {
+		d.budget.elements = d.elements
+	}
+
+	if len(tlvs) == 0 && tlv.Source != nil {
+		tlv.Source.ContentPadding = tlv.Value
+	}
+
+	tlv.TLVs, tlv.Value, tlv.lazy = tlvs, nil, nil
+
+	return tlv.TLVs, nil
+}
+
+// NewTag returns a primitive TLV. The tag is normalized with NormalizeTag;
+// a malformed tag is kept as is and rejected by Encode.
 func NewTag(tag string, value []byte) TLV {
-	return TLV{Tag: tag, Value: value}
+	return TLV{Tag: normalizeTag(tag), Value: value}
 }
 
+// NewComposite returns a constructed TLV with the given children. The tag
+// is normalized like in NewTag.
 func NewComposite(tag string, tlvs ...TLV) TLV {
-	return TLV{Tag: tag, TLVs: tlvs}
+	return TLV{Tag: normalizeTag(tag), TLVs: tlvs}
+}
+
+// Clone returns a deep copy of the TLV and all of its children, sharing no
+// memory with the original, except for the DecodeOptions.OnPadding function
+// of lazily decoded children. The lazy children of the clone count the data
+// objects for DecodeOptions.MaxElements separately from the original,
+// starting from the count at the time of cloning.
+func (tlv TLV) Clone() TLV {
+	return tlv.clone(&lazyCloner{})
+}
+
+func (tlv *TLV) clone(lc *lazyCloner) TLV {
+	c := TLV{
+		Tag:        tlv.Tag,
+		Value:      slices.Clone(tlv.Value),
+		Indefinite: tlv.Indefinite,
+		Source:     tlv.Source.clone(),
+		Raw:        tlv.Raw,
+		lazy:       lc.clone(tlv.lazy),
+	}
+
+	if tlv.TLVs != nil {
+		c.TLVs = make([]TLV, len(tlv.TLVs))
+		for i := range tlv.TLVs {
+			c.TLVs[i] = tlv.TLVs[i].clone(lc)
+		}
+	}
+
+	return c
+}
+
+// lazyCloner deep copies the lazy values of a tree. Lazy values sharing an
+// element budget in the original share one copy of it in the clone.
+type lazyCloner struct {
+	budgets map[*elementBudget]*elementBudget
+}
+
+func (lc *lazyCloner) clone(l *lazyValue) *lazyValue {
+	if l == nil {
+		return nil
+	}
+
+	c := &lazyValue{opts: l.opts, path: slices.Clone(l.path), base: l.base}
+	c.opts.OpaqueTags = slices.Clone(l.opts.OpaqueTags)
+	c.opts.NestedTags = slices.Clone(l.opts.NestedTags)
+
+	if l.budget != nil {
+		budget, ok := lc.budgets[l.budget]
+		if !ok {
+			l.budget.mu.Lock()
+			budget = &elementBudget{elements: l.budget.elements}
+			l.budget.mu.Unlock()
+
+			if lc.budgets == nil {
+				lc.budgets = make(map[*elementBudget]*elementBudget)
+			}
+			lc.budgets[l.budget] = budget
+		}
+		c.budget = budget
+	}
+
+	return c
 }
 
+// endOfContents terminates the value of an indefinite length TLV.
+var endOfContents = []byte{0x00, 0x00}
+
+// Encode encodes the TLVs using BER.
 func Encode(tlvs []TLV) ([]byte, error) {
-	var encoded []byte
+	return EncodeWithOptions(tlvs, EncodeOptions{})
+}
+
+// EncodeWithOptions encodes the TLVs using the given options.
+func EncodeWithOptions(tlvs []TLV, opts EncodeOptions) ([]byte, error) {
+	if opts.DER && opts.Preserve {
+		return nil, errors.New("DER and Preserve cannot be combined")
+	}
+
+	if opts.DER && !opts.minimalLengths() {
+		return nil, errors.New("DER requires minimal lengths")
+	}
+
+	size, err := encodedLen(tlvs, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if size == 0 {
+		return nil, nil
+	}
+
+	return appendEncode(make([]byte, 0, size), tlvs, opts)
+}
+
+// EncodedLen returns the exact number of bytes Encode produces for the TLVs.
+func EncodedLen(tlvs []TLV) (int, error) {
+	return encodedLen(tlvs, EncodeOptions{})
+}
+
+// AppendEncode appends the BER encoding of the TLVs to dst and returns the
+// extended buffer. Every TLV is written once, directly into its final
+// position, so nothing is allocated when dst has room for EncodedLen more
+// bytes.
+func AppendEncode(dst []byte, tlvs []TLV) ([]byte, error) {
+	return appendEncode(dst, tlvs, EncodeOptions{})
+}
+
+// encodedLen returns the number of bytes appendEncode writes for tlvs,
+// validating their tags on the way.
+func encodedLen(tlvs []TLV, opts EncodeOptions) (int, error) {
+	size := 0
 
 	for i := range tlvs {
-		tag, err := hex.DecodeString(tlvs[i].Tag)
+		n, err := encodedSize(&tlvs[i], opts)
 		if err != nil {
-			return nil, fmt.Errorf("encoding tag %s: %w", tlvs[i], err)
+			return 0, err
 		}
+		size += n
+
+		if source := preservedSource(&tlvs[i], opts); source != nil {
+			size += len(source.Padding)
 
-		if err := validateTag(tag); err != nil {
-			return nil, fmt.Errorf("validating tag %s: %w", tlvs[i].Tag, err)
+			if i == len(tlvs)-1 {
+				size += len(source.TrailingPadding)
+			}
 		}
+	}
 
-		// if it's a composite, encode the TLVs recursively
+	return size, nil
+}
+
+// encodedSize returns the number of bytes of the encoded tlv, excluding
+// any padding.
+func encodedSize(tlv *TLV, opts EncodeOptions) (int, error) {
+	if tlv.Raw {
+		return rawLength(tlv, opts)
+	}
+
+	var buf [maxTagBuffer]byte
+	tag, err := appendTag(buf[:0], tlv.Tag)
+	if err != nil {
+		return 0, err
+	}
+
+	length, err := valueLength(tag, tlv, opts)
+	if err != nil {
+		return 0, err
+	}
+
+	if tlv.Indefinite {
+		return len(tag) + 1 + length + len(endOfContents), nil
+	}
+
+	if source := preservedSource(tlv, opts); source != nil && source.keepsLength(length) {
+		return len(tag) + len(source.Length) + length, nil
+	}
+
+	n, err := opts.lengthEncoding(tlv.Tag).size(length)
+	if err != nil {
+		return 0, fmt.Errorf("encoding length of tag %s: %w", tlv.Tag, err)
+	}
+
+	return len(tag) + n + length, nil
+}
+
+// rawLength returns the length of a raw TLV, whose Value is written as is.
+func rawLength(tlv *TLV, opts EncodeOptions) (int, error) {
+	if tlv.Tag != "" || len(tlv.TLVs) > 0 {
+		return 0, errors.New("raw TLV cannot have a tag or nested TLVs")
+	}
+
+	if opts.DER {
+		return 0, errors.New("raw TLV is not allowed in DER")
+	}
 
-		var value []byte
-		if len(tlvs[i].TLVs) > 0 {
-			if !isConstructed(tag) {
-				return nil, fmt.Errorf("tag %s is not constructed/composite", tlvs[i].Tag)
+	return len(tlv.Value), nil
+}
+
+// valueLength returns the length of the encoded value of tlv. The lengths
+// of constructed values are computed from their children, so no
+// intermediate encodings are needed.
+func valueLength(tag []byte, tlv *TLV, opts EncodeOptions) (int, error) {
+	length := len(tlv.Value)
+
+	if padding := contentPadding(tlv, opts); padding != nil {
+		length = len(padding)
+	}
+
+	if len(tlv.TLVs) > 0 {
+		if !isConstructed(tag) {
+			// the TLVs of a primitive tag decoded with
+			// DecodeOptions.NestedTags are a view of its value
+			if len(tlv.Value) > 0 {
+				return length, nil
 			}
 
-			// encode the composite
-			encodedComposite, err := Encode(tlvs[i].TLVs)
-			if err != nil {
-				return nil, fmt.Errorf("encoding composite %s: %w", tlvs[i], err)
+			return 0, fmt.Errorf("tag %s is not constructed/composite", tlv.Tag)
+		}
+
+		if len(tlv.Value) > 0 {
+			return 0, fmt.Errorf("tag %s has both a value and nested TLVs", tlv.Tag)
+		}
+
+		var err error
+		length, err = encodedLen(tlv.TLVs, opts)
+		if err != nil {
+			return 0, fmt.Errorf("encoding composite %s: %w", tlv.Tag, err)
+		}
+	}
+
+	if tlv.Indefinite {
+		if !isConstructed(tag) {
+			return 0, fmt.Errorf("indefinite length is not allowed for primitive tag %s", tlv.Tag)
+		}
+
+		if opts.DER {
+			return 0, fmt.Errorf("indefinite length is not allowed in DER for tag %s", tlv.Tag)
+		}
+	}
+
+	return length, nil
+}
+
+func appendEncode(dst []byte, tlvs []TLV, opts EncodeOptions) ([]byte, error) {
+	for i := range tlvs {
+		tlv := &tlvs[i]
+
+		source := preservedSource(tlv, opts)
+		if source != nil {
+			dst = append(dst, source.Padding...)
+		}
+
+		if tlv.Raw {
+			if _, err := rawLength(tlv, opts); err != nil {
+				return nil, err
+			}
+
+			dst = append(dst, tlv.Value...)
+			if source != nil && i == len(tlvs)-1 {
+				dst = append(dst, source.TrailingPadding...)
 			}
 
-			value = encodedComposite
+			continue
+		}
+
+		var buf [maxTagBuffer]byte
+		tag, err := appendTag(buf[:0], tlv.Tag)
+		if err != nil {
+			return nil, err
+		}
+
+		length, err := valueLength(tag, tlv, opts)
+		if err != nil {
+			return nil, err
+		}
+
+		dst = append(dst, tag...)
+
+		switch {
+		case tlv.Indefinite:
+			dst = append(dst, indefiniteLengthByte)
+		case source != nil && source.keepsLength(length):
+			dst = append(dst, source.Length...)
+		default:
+			encoding := opts.lengthEncoding(tlv.Tag)
+			if _, err := encoding.size(length); err != nil {
+				return nil, fmt.Errorf("encoding length of tag %s: %w", tlv.Tag, err)
+			}
+			dst = encoding.append(dst, length)
+		}
+
+		// if it's a composite, encode the TLVs recursively
+		if len(tlv.TLVs) > 0 && isConstructed(tag) {
+			dst, err = appendComposite(dst, tag, tlv.TLVs, opts)
+			if err != nil {
+				return nil, fmt.Errorf("encoding composite %s: %w", tlv.Tag, err)
+			}
+		} else if padding := contentPadding(tlv, opts); padding != nil {
+			dst = append(dst, padding...)
 		} else {
-			value = tlvs[i].Value
+			dst = append(dst, tlv.Value...)
+		}
+
+		if tlv.Indefinite {
+			dst = append(dst, endOfContents...)
+		}
+
+		if source != nil && i == len(tlvs)-1 {
+			dst = append(dst, source.TrailingPadding...)
+		}
+	}
+
+	return dst, nil
+}
+
+// appendComposite appends the children of the constructed tag. In DER, the
+// elements of a SET OF are sorted by their encodings.
+func appendComposite(dst []byte, tag []byte, tlvs []TLV, opts EncodeOptions) ([]byte, error) {
+	if !opts.DER || !isSet(tag) {
+		return appendEncode(dst, tlvs, opts)
+	}
+
+	elements := make([][]byte, 0, len(tlvs))
+	for i := range tlvs {
+		element, err := appendEncode(nil, tlvs[i:i+1], opts)
+		if err != nil {
+			return nil, err
 		}
+		elements = append(elements, element)
+	}
+
+	slices.SortStableFunc(elements, bytes.Compare)
 
-		length := encodeLength(len(value))
+	for _, element := range elements {
+		dst = append(dst, element...)
+	}
+
+	return dst, nil
+}
+
+// contentPadding returns the preserved padding that made up the value of a
+// constructed TLV, if it still has neither children nor a value.
+func contentPadding(tlv *TLV, opts EncodeOptions) []byte {
+	source := preservedSource(tlv, opts)
+	if source == nil || len(tlv.TLVs) > 0 || len(tlv.Value) > 0 {
+		return nil
+	}
+
+	return source.ContentPadding
+}
 
-		encoded = append(encoded, tag...)
-		encoded = append(encoded, length...)
-		encoded = append(encoded, value...)
+// preservedSource returns the source of tlv if its encoding is preserved.
+func preservedSource(tlv *TLV, opts EncodeOptions) *Source {
+	if !opts.Preserve {
+		return nil
 	}
 
-	return encoded, nil
+	return tlv.Source
 }
 
+// Decode decodes BER-TLV data objects.
 func Decode(data []byte) ([]TLV, error) {
+	return DecodeWithOptions(data, DecodeOptions{})
+}
+
+// DecodeWithOptions decodes BER-TLV data objects using the given options.
+// Errors are returned as *DecodeError.
+func DecodeWithOptions(data []byte, opts DecodeOptions) ([]TLV, error) {
+	if opts.Copy {
+		data = bytes.Clone(data)
+	}
+
+	d := decodeState{opts: opts}
+	if opts.Lazy && opts.MaxElements > 0 {
+		d.budget = &elementBudget{}
+	}
+
+	tlvs, _, err := d.decodeTLVs(data, 0, false)
+	if d.budget != nil {
+		d.budget.elements = d.elements
+	}
+
+	return tlvs, err
+}
+
+// DecodeLenient decodes as much of data as possible. Instead of failing on
+// the first malformed data object, it records the problem and stops
+// decoding the current level, keeping everything decoded before it. The
+// data objects following a malformed constructed TLV are still decoded when
+// its length is known. When opts.KeepRemainder is set, the bytes that could
+// not be decoded are kept as a TLV with an empty Tag.
+func DecodeLenient(data []byte, opts DecodeOptions) ([]TLV, []*DecodeError) {
+	if opts.Copy {
+		data = bytes.Clone(data)
+	}
+
+	d := decodeState{opts: opts, lenient: true}
+
+	tlvs, _, _ := d.decodeTLVs(data, 0, false)
+
+	return tlvs, d.problems
+}
+
+// decodeState holds the options of a single Decode call, the path of the
+// constructed data object being decoded and the number of data objects
+// decoded so far.
+type decodeState struct {
+	opts     DecodeOptions
+	path     []string
+	elements int
+	// budget is shared with the lazy values created while decoding.
+	budget *elementBudget
+
+	// lenient records errors in problems instead of returning them.
+	lenient  bool
+	problems []*DecodeError
+}
+
+// decodeTLVs decodes the data objects in data, which starts at offset base
+// of the input. When indefinite is set, it stops at the end-of-contents
+// marker that terminates an indefinite length value. It returns the TLVs
+// and the number of bytes read.
+func (d *decodeState) decodeTLVs(data []byte, base int, indefinite bool) ([]TLV, int, error) {
 	var tlvs []TLV
 
-	for len(data) > 0 {
-		// read the tag
-		tag, read, err := decodeTag(data)
+	// start of the padding preceding the next data object
+	padding := -1
+
+	pos := 0
+	for pos < len(data) {
+		if indefinite && isEndOfContents(data[pos:]) {
+			d.reportPadding(base, padding, pos)
+			tlvs = d.keepTrailingPadding(tlvs, data, padding, pos)
+
+			return tlvs, pos + len(endOfContents), nil
+		}
+
+		tlv, next, err := d.decodeTLV(data, pos, base)
 		if err != nil {
-			return nil, fmt.Errorf("reading tag: %w", err)
+			return d.recover(tlvs, data, base, padding, pos, err)
 		}
-		data = data[read:]
 
-		// Before, between, or after TLV-coded data objects, '00' bytes
-		// without any meaning may occur (for example, due to erased
-		// or modified TLV-coded data objects). Ignore them.
-		if tag[0] == 0x00 {
+		// padding
+		if tlv == nil {
+			if padding < 0 {
+				padding = pos
+			}
+			pos = next
+
 			continue
 		}
 
-		// read the length
-		length, read, err := decodeLength(data)
+		d.reportPadding(base, padding, pos)
+		if padding >= 0 && tlv.Source != nil {
+			tlv.Source.Padding = data[padding:pos]
+		}
+		padding = -1
+		pos = next
+
+		tlvs = append(tlvs, *tlv)
+	}
+
+	d.reportPadding(base, padding, pos)
+	tlvs = d.keepTrailingPadding(tlvs, data, padding, pos)
+
+	if indefinite {
+		err := d.error(base+pos, "", StageValue, fmt.Errorf("%w: end-of-contents is missing for indefinite length", ErrTruncated))
+
+		return d.recover(tlvs, data, base, -1, pos, err)
+	}
+
+	return tlvs, pos, nil
+}
+
+// decodeTLV decodes the data object starting at data[pos]. It returns the
+// TLV, or nil for padding, and the position of the next data object.
+func (d *decodeState) decodeTLV(data []byte, pos, base int) (*TLV, int, error) {
+	// Before, between, or after TLV-coded data objects, '00' or 'FF'
+	// bytes without any meaning may occur (for example, due to erased
+	// or modified TLV-coded data objects). Ignore them.
+	if d.opts.isPadding(data[pos]) {
+		if err := d.opts.checkPadding(data[pos]); err != nil {
+			return nil, 0, d.error(base+pos, "", StageTag, err)
+		}
+
+		return nil, pos + 1, nil
+	}
+
+	// read the tag
+	tagOffset := pos
+	tag, read, err := decodeTag(data[pos:])
+	if err != nil {
+		return nil, 0, d.error(base+tagOffset, "", StageTag, err)
+	}
+	pos += read
+
+	hexTag := tagString(tag)
+
+	d.elements++
+	if err := d.opts.checkTag(tag, len(d.path)+1, d.elements); err != nil {
+		return nil, 0, d.error(base+tagOffset, hexTag, StageTag, err)
+	}
+
+	// read the length
+	lengthOffset := pos
+	length, read, err := decodeLength(data[pos:])
+	if err != nil {
+		return nil, 0, d.error(base+lengthOffset, hexTag, StageLength, err)
+	}
+
+	if err := d.opts.checkLength(length, read); err != nil {
+		return nil, 0, d.error(base+lengthOffset, hexTag, StageLength, err)
+	}
+	pos += read
+
+	if length == indefiniteLength {
+		if !isConstructed(tag) {
+			return nil, 0, d.error(base+lengthOffset, hexTag, StageLength, fmt.Errorf("%w: indefinite length is not allowed for primitive tag", ErrInvalidLength))
+		}
+
+		problems := len(d.problems)
+
+		d.path = append(d.path, hexTag)
+		decoded, read, err := d.decodeTLVs(data[pos:], base+pos, true)
+		d.path = d.path[:len(d.path)-1]
+		if err != nil {
+			return nil, 0, err
+		}
+
+		tlv := &TLV{Tag: hexTag, TLVs: decoded, Indefinite: true}
+		if d.opts.KeepSource {
+			tlv.Source = newSource(data, base, tagOffset, lengthOffset, pos, pos+read)
+
+			if len(decoded) == 0 && len(d.problems) == problems {
+				tlv.Source.ContentPadding = data[pos : pos+read-len(endOfContents)]
+			}
+		}
+
+		return tlv, pos + read, nil
+	}
+
+	// ensure the value length is within bounds (also reject negative from overflow)
+	if length < 0 || len(data)-pos < length {
+		return nil, 0, d.error(base+pos, hexTag, StageValue, fmt.Errorf("%w: insufficient data for expected length %d", ErrTruncated, length))
+	}
+	value := data[pos : pos+length]
+
+	var tlv *TLV
+
+	// without children, the value of a constructed TLV is all padding,
+	// unless decoding it failed
+	paddingOnly := false
+
+	opaque := isConstructed(tag) && d.opts.isOpaque(hexTag)
+
+	// if it's a composite, decode the TLVs recursively, or on first access
+	// when decoding lazily
+	switch {
+	case opaque:
+		tlv = &TLV{Tag: hexTag, Value: value}
+	case isConstructed(tag) && d.opts.Lazy && !d.lenient:
+		tlv = &TLV{Tag: hexTag, Value: value, lazy: &lazyValue{
+			opts:   d.opts,
+			path:   append(d.path[:len(d.path):len(d.path)], hexTag),
+			base:   base + pos,
+			budget: d.budget,
+		}}
+	case isConstructed(tag):
+		problems := len(d.problems)
+
+		d.path = append(d.path, hexTag)
+		decoded, _, err := d.decodeTLVs(value, base+pos, false)
+		d.path = d.path[:len(d.path)-1]
 		if err != nil {
-			return nil, fmt.Errorf("reading length for tag %X: %w", tag, err)
+			return nil, 0, err
 		}
-		data = data[read:]
 
-		// ensure the value length is within bounds (also reject negative from overflow)
-		if length < 0 || len(data) < length {
-			return nil, fmt.Errorf("insufficient data for expected length %d", length)
+		tlv = &TLV{Tag: hexTag, TLVs: decoded}
+		paddingOnly = len(decoded) == 0 && len(d.problems) == problems
+	default:
+		tlv = &TLV{Tag: hexTag, Value: value, TLVs: d.decodeNested(hexTag, value, base+pos)}
+	}
+
+	if d.opts.KeepSource {
+		tlv.Source = newSource(data, base, tagOffset, lengthOffset, pos, pos+length)
+
+		if paddingOnly {
+			tlv.Source.ContentPadding = value
 		}
-		value := data[:length]
-		data = data[length:]
+	}
 
-		hexTag := strings.ToUpper(hex.EncodeToString(tag))
+	return tlv, pos + length, nil
+}
 
-		// if it's a composite, decode the TLVs recursively
-		if isConstructed(tag) {
-			decoded, err := Decode(value)
-			if err != nil {
-				return nil, fmt.Errorf("decoding composite: %w", err)
+// decodeNested decodes the value of a primitive tag as nested data objects
+// when the options ask for it. It returns nil if the value does not decode
+// cleanly.
+func (d *decodeState) decodeNested(tag string, value []byte, base int) []TLV {
+	if len(value) == 0 || !d.opts.isNested(tag) {
+		return nil
+	}
+
+	nested := decodeState{
+		opts:     d.opts,
+		path:     append(d.path[:len(d.path):len(d.path)], tag),
+		elements: d.elements,
+		budget:   d.budget,
+	}
+	nested.opts.OnPadding = nil
+
+	tlvs, _, err := nested.decodeTLVs(value, base, false)
+	if err != nil {
+		return nil
+	}
+	d.elements = nested.elements
+
+	return tlvs
+}
+
+// reportPadding reports the padding in data[start:end] found at offset
+// base of the input.
+func (d *decodeState) reportPadding(base, start, end int) {
+	if start >= 0 {
+		d.opts.reportPadding(base+start, base+end)
+	}
+}
+
+// keepTrailingPadding records the padding in data[start:end] that follows
+// the last TLV. When there is no TLV, the padding of a constructed value is
+// kept in Source.ContentPadding of the constructed TLV by the caller, while
+// input that is only padding has no TLV to keep it in.
+func (d *decodeState) keepTrailingPadding(tlvs []TLV, data []byte, start, end int) []TLV {
+	if start < 0 || !d.opts.KeepSource || len(tlvs) == 0 {
+		return tlvs
+	}
+
+	tlvs[len(tlvs)-1].Source.TrailingPadding = data[start:end]
+
+	return tlvs
+}
+
+// recover handles an error that stops decoding at data[pos], which follows
+// the padding in data[padding:pos] if padding is not negative. In lenient
+// mode the error is recorded and the TLVs decoded so far are returned,
+// together with the undecodable remainder if requested.
+func (d *decodeState) recover(tlvs []TLV, data []byte, base, padding, pos int, err error) ([]TLV, int, error) {
+	var decodeErr *DecodeError
+	if !d.lenient || !errors.As(err, &decodeErr) {
+		return nil, 0, err
+	}
+
+	d.problems = append(d.problems, decodeErr)
+
+	if d.opts.KeepRemainder && pos < len(data) {
+		remainder := TLV{Value: data[pos:], Raw: true}
+		if d.opts.KeepSource {
+			remainder.Source = &Source{Offset: base + pos, Raw: data[pos:]}
+			if padding >= 0 {
+				remainder.Source.Padding = data[padding:pos]
 			}
-			tlvs = append(tlvs, TLV{Tag: hexTag, TLVs: decoded})
-		} else {
-			tlvs = append(tlvs, TLV{Tag: hexTag, Value: value})
 		}
+
+		tlvs = append(tlvs, remainder)
+	}
+
+	return tlvs, len(data), nil
+}
+
+// error returns a DecodeError for the data object with the given tag inside
+// the current constructed data object. An empty tag refers to the
+// constructed data object itself.
+func (d *decodeState) error(offset int, tag string, stage DecodeStage, err error) error {
+	path := d.path
+	if tag != "" {
+		path = append(path[:len(path):len(path)], tag)
 	}
 
-	return tlvs, nil
+	return newDecodeError(offset, path, stage, err)
+}
+
+// isEndOfContents reports whether data starts with the end-of-contents marker.
+func isEndOfContents(data []byte) bool {
+	return len(data) >= 2 && data[0] == 0x00 && data[1] == 0x00
+}
+
+// tagString returns the upper case hex representation of tag.
+func tagString(tag []byte) string {
+	return strings.ToUpper(hex.EncodeToString(tag))
 }
 
 // PrettyPrint prints the TLVs in a human-readable format.
 func PrettyPrint(tlvs []TLV) {
 	sb := strings.Builder{}
-	prettyPrint(tlvs, &sb, 0)
+	prettyPrint(tlvs, &sb)
 	fmt.Print(sb.String()) //nolint:forbidigo
 }
 
-func prettyPrint(tlvs []TLV, sb *strings.Builder, level int) {
-	for _, tlv := range tlvs {
-		indent := strings.Repeat("  ", level)
+func prettyPrint(tlvs []TLV, sb *strings.Builder) {
+	Walk(tlvs, func(path []string, tlv *TLV) WalkAction {
+		indent := strings.Repeat("  ", len(path)-1)
+
+		if tlv.Raw {
+			sb.WriteString(fmt.Sprintf("%s(raw) %X\n", indent, tlv.Value))
+
+			return WalkContinue
+		}
 
 		tagName, found := emvTags[tlv.Tag]
 
@@ -135,25 +803,27 @@ func prettyPrint(tlvs []TLV, sb *strings.Builder, level int) {
 				sb.WriteString(fmt.Sprintf(" - %s\n", tagName))
 			}
 
-			prettyPrint(tlv.TLVs, sb, level+1)
+			return WalkContinue
+		}
+
+		if filter, ok := tagFilters[tlv.Tag]; ok {
+			sb.WriteString(" " + filter(tlv.Value))
 		} else {
-			if filter, ok := tagFilters[tlv.Tag]; ok {
-				sb.WriteString(" " + filter(tlv.Value))
+			if len(tlv.Value) > 0 {
+				sb.WriteString(fmt.Sprintf(" %X", tlv.Value))
 			} else {
-				if len(tlv.Value) > 0 {
-					sb.WriteString(fmt.Sprintf(" %X", tlv.Value))
-				} else {
-					sb.WriteString(" (empty)")
-				}
+				sb.WriteString(" (empty)")
 			}
+		}
 
-			if found {
-				sb.WriteString(fmt.Sprintf(" - %s\n", tagName))
-			} else {
-				sb.WriteString("\n")
-			}
+		if found {
+			sb.WriteString(fmt.Sprintf(" - %s\n", tagName))
+		} else {
+			sb.WriteString("\n")
 		}
-	}
+
+		return WalkContinue
+	})
 }
 
 // Short Form (Length < 128 bytes) - The first byte is the length of the value
@@ -161,21 +831,52 @@ func prettyPrint(tlvs []TLV, sb *strings.Builder, level int) {
 // Long Form (Length >= 128 bytes) - The first byte is 0b1000_0000 plus the number of
 // bytes used to encode the length of the value field
 func encodeLength(length int) []byte {
+	return appendLength(nil, length)
+}
+
+// appendLength appends the shortest encoding of length to dst.
+func appendLength(dst []byte, length int) []byte {
 	if length < 128 {
 		// short form (length is < 128; mask keeps the conversion provably in range)
-		return []byte{byte(length & 0xFF)}
+		return append(dst, byte(length&0xFF))
 	}
 
 	// long form
-	var lengthBytes []byte
-	for length > 0 {
-		lastByte := byte(length & 0xFF)
-		lengthBytes = append([]byte{lastByte}, lengthBytes...)
-		length >>= 8 // discard the last byte
+	return appendLongLength(dst, length, longLengthBytes(length))
+}
+
+// encodedLengthSize returns the number of bytes encodeLength uses for length.
+func encodedLengthSize(length int) int {
+	if length < 128 {
+		return 1
+	}
+
+	return 1 + longLengthBytes(length)
+}
+
+// maxTagBuffer is the tag size that can be parsed without allocating.
+const maxTagBuffer = 16
+
+// parseTag returns the validated tag bytes of tlv.
+func parseTag(tlv TLV) ([]byte, error) {
+	return appendTag(nil, tlv.Tag)
+}
+
+// appendTag appends the validated bytes of the hex encoded tag to dst.
+// Whitespace in the tag is ignored.
+func appendTag(dst []byte, tag string) ([]byte, error) {
+	start := len(dst)
+
+	dst, err := hex.AppendDecode(dst, []byte(stripSpaces(tag)))
+	if err != nil {
+		return nil, fmt.Errorf("%w: encoding tag %q: %w", ErrInvalidTag, tag, err)
+	}
+
+	if err := validateTag(dst[start:]); err != nil {
+		return nil, fmt.Errorf("%w: validating tag %q: %w", ErrInvalidTag, tag, err)
 	}
 
-	// len(lengthBytes) is small (<= 8); mask keeps the conversion provably in range.
-	return append([]byte{byte((0b1000_0000 | len(lengthBytes)) & 0xFF)}, lengthBytes...)
+	return dst, nil
 }
 
 func validateTag(tag []byte) error {
@@ -223,7 +924,7 @@ func isConstructed(tag []byte) bool {
 
 func decodeTag(data []byte) ([]byte, int, error) {
 	if len(data) == 0 {
-		return nil, 0, errors.New("tag is empty")
+		return nil, 0, fmt.Errorf("%w: tag is empty", ErrTruncated)
 	}
 
 	if !isMultiByte(data) {
@@ -238,12 +939,22 @@ func decodeTag(data []byte) ([]byte, int, error) {
 		}
 	}
 
-	return nil, len(data), errors.New("tag is incomplete")
+	return nil, len(data), fmt.Errorf("%w: tag is incomplete", ErrTruncated)
 }
 
+const (
+	// indefiniteLengthByte is the length octet of the indefinite form.
+	indefiniteLengthByte = 0b1000_0000
+
+	// indefiniteLength is returned by decodeLength for the indefinite form.
+	indefiniteLength = -1
+)
+
+// decodeLength returns the length, the number of bytes read and an error.
+// For the indefinite form it returns indefiniteLength.
 func decodeLength(data []byte) (int, int, error) {
 	if len(data) == 0 {
-		return 0, 0, errors.New("length is empty")
+		return 0, 0, fmt.Errorf("%w: length is empty", ErrTruncated)
 	}
 
 	if data[0] < 128 {
@@ -254,18 +965,18 @@ func decodeLength(data []byte) (int, int, error) {
 	// long form
 	lengthBytes := int(data[0] & 0b0111_1111)
 	if lengthBytes == 0 {
-		// BER indefinite length is not supported
-		return 0, 0, errors.New("indefinite length is not supported")
+		// BER indefinite length, the value ends with end-of-contents
+		return indefiniteLength, 1, nil
 	}
 	// A length encoded in more than 8 bytes cannot fit in a 64-bit int.
 	// Reject it so the accumulation below cannot overflow into a bogus
 	// (possibly negative) value that would bypass the caller's bounds
 	// check and cause a slice-out-of-range panic on malformed input.
 	if lengthBytes > 8 {
-		return 0, 0, fmt.Errorf("length field too large: %d bytes", lengthBytes)
+		return 0, 0, fmt.Errorf("%w: length field too large: %d bytes", ErrInvalidLength, lengthBytes)
 	}
 	if len(data) < lengthBytes+1 {
-		return 0, 0, errors.New("length is incomplete")
+		return 0, 0, fmt.Errorf("%w: length is incomplete", ErrTruncated)
 	}
 
 	var length int
@@ -275,7 +986,7 @@ func decodeLength(data []byte) (int, int, error) {
 		// misses wrap-to-positive cases on 32-bit int).
 		next := data[i]
 		if length > (int(^uint(0)>>1)-int(next))/256 {
-			return 0, 0, errors.New("length overflows")
+			return 0, 0, fmt.Errorf("%w: length overflows", ErrInvalidLength)
 		}
 		length = length<<8 | int(next)
 	}
@@ -284,45 +995,100 @@ func decodeLength(data []byte) (int, int, error) {
 	// 64-bit platforms, producing a negative length. Reject it rather
 	// than passing it to a slice expression.
 	if length < 0 {
-		return 0, 0, errors.New("length overflow: value too large")
+		return 0, 0, fmt.Errorf("%w: length overflow: value too large", ErrInvalidLength)
 	}
 
 	return length, lengthBytes + 1, nil
 }
 
-// FindTagByPath returns the TLV with the specified path.
+// FindTagByPath returns the TLV with the specified path. Tags in the path
+// are matched as described in NormalizeTag.
 func FindTagByPath(tlvs []TLV, path string) (TLV, bool) {
-	tag, path, _ := strings.Cut(path, ".")
+	tags, err := normalizePath(path)
+	if err != nil {
+		return TLV{}, false
+	}
 
-	for _, tlv := range tlvs {
-		if tlv.Tag == tag {
-			if path == "" {
-				return tlv, true
-			}
+	for i, tag := range tags {
+		last := i == len(tags)-1
 
-			if len(tlv.TLVs) > 0 {
-				return FindTagByPath(tlv.TLVs, path)
-			}
+		k := indexPathTag(tlvs, tag, last)
+		if k < 0 {
+			break
+		}
+
+		if last {
+			return tlvs[k], true
 		}
+
+		tlvs = tlvs[k].TLVs
 	}
 
 	return TLV{}, false
 }
 
 // FindFirstTag returns the first TLV with the specified tag. It searches
-// recursively.
+// recursively. The tag is matched as described in NormalizeTag.
 func FindFirstTag(tlvs []TLV, tag string) (TLV, bool) {
-	for _, tlv := range tlvs {
-		if tlv.Tag == tag {
-			return tlv, true
-		}
+	tag, err := NormalizeTag(tag)
+	if err != nil {
+		return TLV{}, false
+	}
 
-		if len(tlv.TLVs) > 0 {
-			return FindFirstTag(tlv.TLVs, tag)
+	return findFirstTag(tlvs, tag)
+}
+
+func findFirstTag(tlvs []TLV, tag string) (TLV, bool) {
+	var found *TLV
+
+	Walk(tlvs, func(_ []string, tlv *TLV) WalkAction {
+		if sameTag(tlv.Tag, tag) {
+			found = tlv
+
+			return WalkStop
 		}
+
+		return WalkContinue
+	})
+
+	if found == nil {
+		return TLV{}, false
 	}
 
-	return TLV{}, false
+	return *found, true
+}
+
+// TagMatch is a TLV found by FindAllTags or a Query.
+type TagMatch struct {
+	Path Path
+	TLV  TLV
+}
+
+// FindAllTags returns every TLV with the specified tag in depth-first
+// order, together with its path. The tag is matched as described in
+// NormalizeTag.
+func FindAllTags(tlvs []TLV, tag string) []TagMatch {
+	tag, err := NormalizeTag(tag)
+	if err != nil {
+		return nil
+	}
+
+	var matches []TagMatch
+
+	Walk(tlvs, func(path []string, tlv *TLV) WalkAction {
+		if sameTag(tlv.Tag, tag) {
+			match := TagMatch{Path: make([]string, len(path)), TLV: *tlv}
+			for i := range path {
+				match.Path[i] = normalizeTag(path[i])
+			}
+
+			matches = append(matches, match)
+		}
+
+		return WalkContinue
+	})
+
+	return matches
 }
 
 type fieldTag struct {
@@ -352,7 +1118,7 @@ func Unmarshal(tlvs []TLV, s any) error {
 	// let's create map for lookup
 	tagToValue := make(map[string]TLV)
 	for _, tlv := range tlvs {
-		tagToValue[tlv.Tag] = tlv
+		tagToValue[normalizeTag(tlv.Tag)] = tlv
 	}
 
 	v := reflect.ValueOf(s)
@@ -376,7 +1142,12 @@ func Unmarshal(tlvs []TLV, s any) error {
 			continue
 		}
 
-		tlv, ok := tagToValue[tag.name]
+		name, err := NormalizeTag(tag.name)
+		if err != nil {
+			return fmt.Errorf("field %s: %w", typeField.Name, err)
+		}
+
+		tlv, ok := tagToValue[name]
 		if !ok {
 			continue
 		}
@@ -424,25 +1195,35 @@ func Unmarshal(tlvs []TLV, s any) error {
 // CopyTags creates a new slice containing only TLVs with the specified tags.
 // It performs a deep copy of the matching TLVs, ensuring the original data is not modified.
 // When a parent TLV is included in the tags list, its entire subtree is copied.
+// Tags are matched as described in NormalizeTag.
 func CopyTags(tlvs []TLV, tags ...string) []TLV {
-	if len(tlvs) == 0 || len(tags) == 0 {
-		return nil
-	}
-
 	// Create a map for O(1) lookups of allowed tags
 	tagsToCopy := make(map[string]bool, len(tags))
 	for _, tag := range tags {
-		tagsToCopy[tag] = true
+		if tag, err := NormalizeTag(tag); err == nil {
+			tagsToCopy[tag] = true
+		}
+	}
+
+	return copyTags(tlvs, tagsToCopy, &lazyCloner{})
+}
+
+func copyTags(tlvs []TLV, tagsToCopy map[string]bool, lc *lazyCloner) []TLV {
+	if len(tlvs) == 0 || len(tagsToCopy) == 0 {
+		return nil
 	}
 
 	// Create a new slice for the result
-	result := make([]TLV, 0, len(tags)) // Pre-allocate for efficiency
+	result := make([]TLV, 0, len(tagsToCopy)) // Pre-allocate for efficiency
 
 	// Filter and copy the TLVs
 	for _, tlv := range tlvs {
-		if tagsToCopy[tlv.Tag] {
+		if tagsToCopy[normalizeTag(tlv.Tag)] {
 			copiedTLV := TLV{
-				Tag: tlv.Tag,
+				Tag:        tlv.Tag,
+				Indefinite: tlv.Indefinite,
+				Source:     tlv.Source.clone(),
+				lazy:       lc.clone(tlv.lazy),
 			}
 
 			if len(tlv.Value) > 0 {
@@ -452,7 +1233,7 @@ func CopyTags(tlvs []TLV, tags ...string) []TLV {
 
 			// Deep copy nested TLVs if they exist (entire subtree)
 			if len(tlv.TLVs) > 0 {
-				copiedTLV.TLVs = deepCopyTLVs(tlv.TLVs)
+				copiedTLV.TLVs = deepCopyTLVs(tlv.TLVs, lc)
 			}
 
 			result = append(result, copiedTLV)
@@ -467,7 +1248,7 @@ func CopyTags(tlvs []TLV, tags ...string) []TLV {
 }
 
 // deepCopyTLVs creates a deep copy of a slice of TLVs
-func deepCopyTLVs(tlvs []TLV) []TLV {
+func deepCopyTLVs(tlvs []TLV, lc *lazyCloner) []TLV {
 	if len(tlvs) == 0 {
 		return nil
 	}
@@ -475,7 +1256,11 @@ func deepCopyTLVs(tlvs []TLV) []TLV {
 	result := make([]TLV, 0, len(tlvs))
 	for _, tlv := range tlvs {
 		copiedTLV := TLV{
-			Tag: tlv.Tag,
+			Tag:        tlv.Tag,
+			Indefinite: tlv.Indefinite,
+			Source:     tlv.Source.clone(),
+			Raw:        tlv.Raw,
+			lazy:       lc.clone(tlv.lazy),
 		}
 
 		// Deep copy the Value slice if it exists
@@ -486,7 +1271,7 @@ func deepCopyTLVs(tlvs []TLV) []TLV {
 
 		// Recursively copy nested TLVs if they exist
 		if len(tlv.TLVs) > 0 {
-			copiedTLV.TLVs = deepCopyTLVs(tlv.TLVs)
+			copiedTLV.TLVs = deepCopyTLVs(tlv.TLVs, lc)
 		}
 
 		result = append(result, copiedTLV)
@@ -1,8 +1,10 @@
 package bertlv_test
 
 import (
+	"bytes"
 	"encoding/hex"
 	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/moov-io/bertlv"
@@ -38,6 +40,320 @@ func TestEncodeDecode(t *testing.T) {
 	require.Equal(t, data, decoded)
 }
 
+func TestEncodeDecodeIndefiniteLength(t *testing.T) {
+	// SEQUENCE (indefinite) { INTEGER 1, SET (indefinite) { OCTET STRING }, SEQUENCE {} }
+	encoded, err := hex.DecodeString("3080" + "020101" + "3180" + "0402AABB" + "0000" + "3000" + "0000" + "5A0111")
+	require.NoError(t, err)
+
+	decoded, err := bertlv.Decode(encoded)
+	require.NoError(t, err)
+
+	expected := []bertlv.TLV{
+		{Tag: "30", Indefinite: true, TLVs: []bertlv.TLV{
+			bertlv.NewTag("02", []byte{0x01}),
+			{Tag: "31", Indefinite: true, TLVs: []bertlv.TLV{
+				bertlv.NewTag("04", []byte{0xAA, 0xBB}),
+			}},
+			{Tag: "30"},
+		}},
+		bertlv.NewTag("5A", []byte{0x11}),
+	}
+	require.Equal(t, expected, decoded)
+
+	reencoded, err := bertlv.Encode(decoded)
+	require.NoError(t, err)
+	require.Equal(t, encoded, reencoded)
+
+	// padding is still skipped inside indefinite length values
+	decoded, err = bertlv.Decode([]byte{0x30, 0x80, 0x00, 0x02, 0x01, 0x01, 0x00, 0x00})
+	require.NoError(t, err)
+	require.Equal(t, []bertlv.TLV{
+		{Tag: "30", Indefinite: true, TLVs: []bertlv.TLV{bertlv.NewTag("02", []byte{0x01})}},
+	}, decoded)
+
+	// primitive tags cannot use the indefinite form
+	_, err = bertlv.Encode([]bertlv.TLV{{Tag: "5A", Value: []byte{0x11}, Indefinite: true}})
+	require.Error(t, err)
+}
+
+func TestEncodedLenAndAppendEncode(t *testing.T) {
+	data := []bertlv.TLV{
+		bertlv.NewComposite("6F",
+			bertlv.NewTag("84", []byte{0x32, 0x50, 0x41, 0x59}),
+			bertlv.NewComposite("A5",
+				bertlv.NewTag("9F10", make([]byte, 200)),
+			),
+		),
+		{Tag: "30", Indefinite: true, TLVs: []bertlv.TLV{bertlv.NewTag("02", []byte{0x01})}},
+		bertlv.NewTag("5A", []byte{0x11}),
+	}
+
+	encoded, err := bertlv.Encode(data)
+	require.NoError(t, err)
+
+	size, err := bertlv.EncodedLen(data)
+	require.NoError(t, err)
+	require.Equal(t, len(encoded), size)
+
+	prefix := []byte{0xCA, 0xFE}
+	appended, err := bertlv.AppendEncode(prefix, data)
+	require.NoError(t, err)
+	require.Equal(t, append([]byte{0xCA, 0xFE}, encoded...), appended)
+
+	// no allocations when the buffer is large enough
+	buf := make([]byte, 0, size)
+	allocs := testing.AllocsPerRun(100, func() {
+		buf, _ = bertlv.AppendEncode(buf[:0], data)
+	})
+	require.Zero(t, allocs)
+	require.Equal(t, encoded, buf)
+
+	// invalid tags are reported by both
+	invalid := []bertlv.TLV{bertlv.NewComposite("70", bertlv.NewTag("9F", nil))}
+
+	_, err = bertlv.EncodedLen(invalid)
+	require.ErrorContains(t, err, "encoding composite 70")
+
+	_, err = bertlv.AppendEncode(nil, invalid)
+	require.ErrorContains(t, err, "encoding composite 70")
+}
+
+func TestDecodeOpaqueTags(t *testing.T) {
+	// BF0C carries proprietary content that is not BER-TLV encoded
+	data, err := hex.DecodeString("7009" + "BF0C03FFFFFF" + "5A0111")
+	require.NoError(t, err)
+
+	_, err = bertlv.Decode(data)
+	require.ErrorIs(t, err, bertlv.ErrTruncated)
+
+	opts := bertlv.DecodeOptions{OpaqueTags: []string{"bf0c"}}
+
+	decoded, err := bertlv.DecodeWithOptions(data, opts)
+	require.NoError(t, err)
+
+	expected := []bertlv.TLV{
+		bertlv.NewComposite("70",
+			bertlv.TLV{Tag: "BF0C", Value: []byte{0xFF, 0xFF, 0xFF}},
+			bertlv.NewTag("5A", []byte{0x11}),
+		),
+	}
+	require.Equal(t, expected, decoded)
+
+	tlv, err := bertlv.NewDecoderWithOptions(bytes.NewReader(data), opts).Next()
+	require.NoError(t, err)
+	require.Equal(t, expected[0], tlv)
+
+	// the value of a constructed TLV without TLVs is written as is
+	encoded, err := bertlv.Encode(decoded)
+	require.NoError(t, err)
+	require.Equal(t, data, encoded)
+
+	// setting both is ambiguous
+	_, err = bertlv.Encode([]bertlv.TLV{{Tag: "BF0C", Value: []byte{0xFF}, TLVs: []bertlv.TLV{bertlv.NewTag("5A", nil)}}})
+	require.ErrorContains(t, err, "tag BF0C has both a value and nested TLVs")
+}
+
+func TestDecodeNestedTags(t *testing.T) {
+	// 9F10 holds data objects DF01 and DF02, 5A does not
+	data, err := hex.DecodeString("9F1008" + "DF010112DF020134" + "5A0111")
+	require.NoError(t, err)
+
+	decoded, err := bertlv.Decode(data)
+	require.NoError(t, err)
+	require.Nil(t, decoded[0].TLVs)
+
+	nested := []bertlv.TLV{
+		bertlv.NewTag("DF01", []byte{0x12}),
+		bertlv.NewTag("DF02", []byte{0x34}),
+	}
+
+	for _, opts := range []bertlv.DecodeOptions{
+		{NestedTags: []string{"9f10"}},
+		{NestedHeuristic: true},
+	} {
+		decoded, err := bertlv.DecodeWithOptions(data, opts)
+		require.NoError(t, err)
+
+		require.Equal(t, []bertlv.TLV{
+			{Tag: "9F10", Value: data[3:11], TLVs: nested},
+			bertlv.NewTag("5A", []byte{0x11}),
+		}, decoded)
+
+		// the original value is encoded
+		decoded[0].TLVs[0].Value = []byte{0xFF}
+		encoded, err := bertlv.Encode(decoded)
+		require.NoError(t, err)
+		require.Equal(t, data, encoded)
+	}
+
+	// limits apply to the nested data objects
+	decoded, err = bertlv.DecodeWithOptions(data, bertlv.DecodeOptions{NestedTags: []string{"9F10"}, MaxDepth: 1})
+	require.NoError(t, err)
+	require.Nil(t, decoded[0].TLVs)
+}
+
+func TestDecodeCopy(t *testing.T) {
+	data, err := hex.DecodeString("7003" + "5A0111" + "9F020100")
+	require.NoError(t, err)
+
+	aliased, err := bertlv.Decode(data)
+	require.NoError(t, err)
+
+	copied, err := bertlv.DecodeWithOptions(data, bertlv.DecodeOptions{Copy: true, KeepSource: true})
+	require.NoError(t, err)
+
+	lenient, _ := bertlv.DecodeLenient(data, bertlv.DecodeOptions{Copy: true})
+
+	// reuse the input buffer
+	for i := range data {
+		data[i] = 0xEE
+	}
+
+	require.Equal(t, []byte{0xEE}, aliased[0].TLVs[0].Value)
+	require.Equal(t, []byte{0x11}, copied[0].TLVs[0].Value)
+	require.Equal(t, []byte{0x9F, 0x02, 0x01, 0x00}, copied[1].Source.Raw)
+	require.Equal(t, []byte{0x11}, lenient[0].TLVs[0].Value)
+}
+
+func TestTLVClone(t *testing.T) {
+	data, err := hex.DecodeString("3080" + "7003" + "5A0111" + "0000" + "9F0200")
+	require.NoError(t, err)
+
+	decoded, err := bertlv.DecodeWithOptions(data, bertlv.DecodeOptions{KeepSource: true})
+	require.NoError(t, err)
+
+	clone := decoded[0].Clone()
+	require.Equal(t, decoded[0], clone)
+
+	empty := decoded[1].Clone()
+	require.Equal(t, decoded[1], empty)
+	require.NotNil(t, empty.Value)
+
+	// the clone shares no memory with the original
+	for i := range data {
+		data[i] = 0xEE
+	}
+	require.Equal(t, []byte{0x11}, clone.TLVs[0].TLVs[0].Value)
+	require.Equal(t, []byte{0x5A, 0x01, 0x11}, clone.TLVs[0].TLVs[0].Source.Raw)
+}
+
+func TestTLVCloneLazy(t *testing.T) {
+	data, err := hex.DecodeString("70035A0111" + "71035A0122")
+	require.NoError(t, err)
+
+	decoded, err := bertlv.DecodeWithOptions(data, bertlv.DecodeOptions{Lazy: true, MaxElements: 3})
+	require.NoError(t, err)
+
+	clone := decoded[0].Clone()
+	copied := bertlv.CopyTags(decoded, "70")
+
+	_, err = decoded[0].Children()
+	require.NoError(t, err)
+
+	_, err = decoded[1].Children()
+	require.ErrorIs(t, err, bertlv.ErrTooManyElements)
+
+	// the copies count the elements separately from the original
+	children, err := clone.Children()
+	require.NoError(t, err)
+	require.Equal(t, decoded[0].TLVs, children)
+
+	children, err = copied[0].Children()
+	require.NoError(t, err)
+	require.Equal(t, decoded[0].TLVs, children)
+}
+
+func TestDecodeLazy(t *testing.T) {
+	data, err := hex.DecodeString("7009" + "A5035A0111" + "9F0201FF" + "5A0122")
+	require.NoError(t, err)
+
+	expected, err := bertlv.Decode(data)
+	require.NoError(t, err)
+
+	decoded, err := bertlv.DecodeWithOptions(data, bertlv.DecodeOptions{Lazy: true})
+	require.NoError(t, err)
+
+	// the children of 70 are not decoded yet, but encoded as they were
+	require.Nil(t, decoded[0].TLVs)
+	require.Equal(t, data[2:11], decoded[0].Value)
+
+	encoded, err := bertlv.Encode(decoded)
+	require.NoError(t, err)
+	require.Equal(t, data, encoded)
+
+	children, err := decoded[0].Children()
+	require.NoError(t, err)
+	require.Len(t, children, 2)
+	require.Nil(t, decoded[0].Value)
+	require.Equal(t, expected[0].TLVs[1], children[1])
+
+	nested, err := children[0].Children()
+	require.NoError(t, err)
+	require.Equal(t, expected[0].TLVs[0].TLVs, nested)
+
+	require.Equal(t, expected, decoded)
+
+	// primitive and expanded TLVs have no lazy children
+	children, err = decoded[1].Children()
+	require.NoError(t, err)
+	require.Nil(t, children)
+}
+
+func TestDecodeLazyErrors(t *testing.T) {
+	data, err := hex.DecodeString("7004" + "A502" + "5A05")
+	require.NoError(t, err)
+
+	_, expected := bertlv.Decode(data)
+	requireDecodeError(t, expected, 6, "70.A5.5A", bertlv.StageValue, bertlv.ErrTruncated)
+
+	decoded, err := bertlv.DecodeWithOptions(data, bertlv.DecodeOptions{Lazy: true})
+	require.NoError(t, err)
+
+	children, err := decoded[0].Children()
+	require.NoError(t, err)
+
+	// the error surfaces on access, the same as from Decode
+	_, err = children[0].Children()
+	require.Equal(t, expected, err)
+
+	// the TLV stays unexpanded
+	_, err = children[0].Children()
+	require.Equal(t, expected, err)
+}
+
+func TestDecodeLazyMaxElements(t *testing.T) {
+	data, err := hex.DecodeString("70035A0111" + "71035A0122")
+	require.NoError(t, err)
+
+	opts := bertlv.DecodeOptions{MaxElements: 3}
+
+	_, expected := bertlv.DecodeWithOptions(data, opts)
+	requireDecodeError(t, expected, 7, "71.5A", bertlv.StageTag, bertlv.ErrTooManyElements)
+
+	opts.Lazy = true
+	decoded, err := bertlv.DecodeWithOptions(data, opts)
+	require.NoError(t, err)
+
+	_, err = decoded[0].Children()
+	require.NoError(t, err)
+
+	// the expansions draw from the element count of the whole input
+	_, err = decoded[1].Children()
+	require.Equal(t, expected, err)
+
+	// so do the lazy values inside nested values
+	data, err = hex.DecodeString("9F1005" + "70035A0111")
+	require.NoError(t, err)
+
+	opts = bertlv.DecodeOptions{Lazy: true, NestedTags: []string{"9F10"}, MaxElements: 2}
+	decoded, err = bertlv.DecodeWithOptions(data, opts)
+	require.NoError(t, err)
+	require.Len(t, decoded[0].TLVs, 1)
+
+	_, err = decoded[0].TLVs[0].Children()
+	requireDecodeError(t, err, 5, "9F10.70.5A", bertlv.StageTag, bertlv.ErrTooManyElements)
+}
+
 func TestFindTag(t *testing.T) {
 	_, found := bertlv.FindTagByPath([]bertlv.TLV{}, "00")
 	require.False(t, found)
@@ -69,6 +385,113 @@ func TestFindTag(t *testing.T) {
 	require.Equal(t, []byte{0xA0, 0x00, 0x00, 0x00, 0x04, 0x10, 0x10}, tag.Value)
 }
 
+func TestTagNormalization(t *testing.T) {
+	data := []bertlv.TLV{
+		// tags of TLV literals are not normalized on construction
+		{Tag: "5f2d", Value: []byte("en")},
+		bertlv.NewComposite("6f",
+			bertlv.NewTag("84", []byte{0x01}),
+			bertlv.NewComposite("a5",
+				bertlv.NewTag("9f 38", []byte{0x02}),
+			),
+		),
+	}
+
+	require.Equal(t, "6F", data[1].Tag)
+	require.Equal(t, "9F38", data[1].TLVs[1].TLVs[0].Tag)
+
+	tlv, found := bertlv.FindTagByPath(data, "6f.A5.9f38")
+	require.True(t, found)
+	require.Equal(t, []byte{0x02}, tlv.Value)
+
+	_, found = bertlv.FindFirstTag(data, "5F 2D")
+	require.True(t, found)
+
+	_, found = bertlv.FindFirstTag(data, "9F")
+	require.False(t, found)
+
+	copied := bertlv.CopyTags(data, "5F2D", "not a tag")
+	require.Len(t, copied, 1)
+
+	tagMap := bertlv.BuildTagMap(data)
+	_, found = bertlv.FindFirst(tagMap, "5f2d")
+	require.True(t, found)
+
+	var fields struct {
+		Language string `bertlv:"5F2D,ascii"`
+	}
+	require.NoError(t, bertlv.Unmarshal(data, &fields))
+	require.Equal(t, "en", fields.Language)
+
+	// malformed tags are rejected instead of silently matching nothing
+	var invalid struct {
+		Field []byte `bertlv:"9F"`
+	}
+	err := bertlv.Unmarshal(data, &invalid)
+	require.ErrorIs(t, err, bertlv.ErrInvalidTag)
+	require.ErrorContains(t, err, "field Field")
+
+	_, err = bertlv.Encode([]bertlv.TLV{bertlv.NewTag("9G", nil)})
+	require.ErrorIs(t, err, bertlv.ErrInvalidTag)
+
+	// lookups of malformed tags find nothing, queries report them
+	_, found = bertlv.FindTagByPath(data, "6F.9G")
+	require.False(t, found)
+
+	_, err = bertlv.CompileQuery("6F.9G")
+	require.ErrorIs(t, err, bertlv.ErrInvalidTag)
+
+	encoded, err := bertlv.Encode(data)
+	require.NoError(t, err)
+	require.Equal(t, "5F2D02656E6F09840101A5049F380102", fmt.Sprintf("%X", encoded))
+}
+
+func TestFindTagInSiblingTemplates(t *testing.T) {
+	data := []bertlv.TLV{
+		bertlv.NewComposite("70",
+			bertlv.NewTag("5A", []byte{0x11}),
+			bertlv.NewComposite("A5",
+				bertlv.NewTag("9F10", []byte{0x01}),
+			),
+		),
+		bertlv.NewComposite("77",
+			bertlv.NewTag("9F27", []byte{0x80}),
+			bertlv.NewTag("9F10", []byte{0x02}),
+		),
+		bertlv.NewTag("9F10", []byte{0x03}),
+	}
+
+	// tags after an earlier template are found
+	tlv, found := bertlv.FindFirstTag(data, "9F27")
+	require.True(t, found)
+	require.Equal(t, []byte{0x80}, tlv.Value)
+
+	// the first match in depth-first order wins
+	tlv, found = bertlv.FindFirstTag(data, "9F10")
+	require.True(t, found)
+	require.Equal(t, []byte{0x01}, tlv.Value)
+
+	_, found = bertlv.FindFirstTag(data, "9F36")
+	require.False(t, found)
+
+	matches := bertlv.FindAllTags(data, "9f10")
+	require.Equal(t, []bertlv.TagMatch{
+		{Path: []string{"70", "A5", "9F10"}, TLV: bertlv.NewTag("9F10", []byte{0x01})},
+		{Path: []string{"77", "9F10"}, TLV: bertlv.NewTag("9F10", []byte{0x02})},
+		{Path: []string{"9F10"}, TLV: bertlv.NewTag("9F10", []byte{0x03})},
+	}, matches)
+
+	// paths can be passed to FindTagByPath
+	for _, match := range matches {
+		tlv, found := bertlv.FindTagByPath(data, strings.Join(match.Path, "."))
+		require.True(t, found)
+		require.Equal(t, match.TLV, tlv)
+	}
+
+	require.Nil(t, bertlv.FindAllTags(data, "9F36"))
+	require.Nil(t, bertlv.FindAllTags(data, "9F"))
+}
+
 func TestUnmarshalSuccess(t *testing.T) {
 	data := []bertlv.TLV{
 		bertlv.NewTag("84", []byte{0x32, 0x50, 0x41, 0x59, 0x2E, 0x53, 0x59, 0x53, 0x2E, 0x44, 0x44, 0x46, 0x30, 0x31}),
@@ -375,10 +798,15 @@ func TestDecodeMalformedLengthDoesNotPanic(t *testing.T) {
 			data: []byte{0x5A, 0x84, 0x80, 0x00, 0x00, 0x00},
 		},
 		{
-			// BER indefinite length (0x80) is not supported.
+			// BER indefinite length (0x80) is not allowed for primitive tags.
 			name: "indefinite length",
 			data: []byte{0x5A, 0x80},
 		},
+		{
+			// Indefinite length constructed tag without end-of-contents.
+			name: "indefinite length without end-of-contents",
+			data: []byte{0x30, 0x80, 0x5A, 0x01, 0x11},
+		},
 	}
 
 	for _, tt := range tests {
@@ -404,6 +832,7 @@ func FuzzDecode(f *testing.F) {
 	f.Add([]byte{0x30, 0x89, 0x30, 0x89, 0x00, 0x00, 0x00, 0x00, 0x00})
 	f.Add([]byte("0\x9c00000000000000000000\x9c0000000"))
 	f.Add([]byte{0x5A, 0x80}) // indefinite length
+	f.Add([]byte{0x30, 0x80, 0x02, 0x01, 0x01, 0x00, 0x00})
 	f.Add([]byte{0x5A, 0x84, 0x80, 0x00, 0x00, 0x00})
 	// Real-world EMV samples (from library tests / payment processing)
 	for _, h := range []string{
@@ -442,3 +871,24 @@ func FuzzDecode(f *testing.F) {
 		_, _ = bertlv.FindTagByPath(tlvs, "6F")
 	})
 }
+
+func BenchmarkEncode(b *testing.B) {
+	data, _ := hex.DecodeString("6F2F840E325041592E5359532E4444463031A51DBF0C1A61184F07A0000000041010500A4D617374657263617264870101")
+	tlvs, _ := bertlv.Decode(data)
+
+	b.Run("Encode", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			_, _ = bertlv.Encode(tlvs)
+		}
+	})
+
+	b.Run("AppendEncode", func(b *testing.B) {
+		buf := make([]byte, 0, len(data))
+
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			buf, _ = bertlv.AppendEncode(buf[:0], tlvs)
+		}
+	})
+}
@@ -0,0 +1,61 @@
+package bertlv
+
+import (
+	"fmt"
+)
+
+// WalkAction tells Walk how to continue after visiting a TLV.
+type WalkAction int
+
+const (
+	// WalkContinue visits the children of the TLV, then its siblings.
+	WalkContinue WalkAction = iota
+	// WalkSkip skips the children of the TLV.
+	WalkSkip
+	// WalkStop ends the walk.
+	WalkStop
+)
+
+func (a WalkAction) String() string {
+	switch a {
+	case WalkContinue:
+		return "continue"
+	case WalkSkip:
+		return "skip"
+	case WalkStop:
+		return "stop"
+	default:
+		return fmt.Sprintf("WalkAction(%d)", int(a))
+	}
+}
+
+// Walk calls fn for every TLV in depth-first order. The path holds the
+// tags from the top level down to and including the visited TLV, so its
+// length is the depth of the TLV (1 at the top level). The path is reused
+// between calls; copy it to keep it.
+//
+// The TLV is passed by pointer into the tree, so fn can edit it in place.
+// Children are visited after fn returns, so replaced children are walked.
+func Walk(tlvs []TLV, fn func(path []string, tlv *TLV) WalkAction) {
+	walk(tlvs, nil, fn)
+}
+
+// walk visits tlvs below path. It returns false when the walk was stopped.
+func walk(tlvs []TLV, path []string, fn func(path []string, tlv *TLV) WalkAction) bool {
+	for i := range tlvs {
+		path := append(path, tlvs[i].Tag)
+
+		switch fn(path, &tlvs[i]) {
+		case WalkStop:
+			return false
+		case WalkSkip:
+			continue
+		}
+
+		if !walk(tlvs[i].TLVs, path, fn) {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,99 @@
+package bertlv_test
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/moov-io/bertlv"
+	"github.com/stretchr/testify/require"
+)
+
+// testTLVs returns the tree shared by the walking, iterator and query
+// tests: an FCI with two application templates, two record templates and
+// a top level 9F10.
+func testTLVs() []bertlv.TLV {
+	return []bertlv.TLV{
+		bertlv.NewComposite("6F",
+			bertlv.NewTag("84", []byte{0x32, 0x50, 0x41, 0x59}),
+			bertlv.NewComposite("A5",
+				bertlv.NewComposite("BF0C",
+					bertlv.NewComposite("61",
+						bertlv.NewTag("4F", []byte{0xA0, 0x00, 0x00, 0x00, 0x03, 0x10, 0x10}),
+						bertlv.NewTag("50", []byte("VISA")),
+					),
+					bertlv.NewComposite("61",
+						bertlv.NewTag("4F", []byte{0xA0, 0x00, 0x00, 0x00, 0x04, 0x10, 0x10}),
+						bertlv.NewTag("50", []byte("MASTERCARD")),
+					),
+				),
+			),
+		),
+		bertlv.NewComposite("70", bertlv.NewTag("57", []byte{0x01})),
+		bertlv.NewComposite("70",
+			bertlv.NewTag("57", []byte{0x02}),
+			bertlv.NewComposite("77", bertlv.NewTag("9F10", []byte{0x03})),
+		),
+		bertlv.NewTag("9F10", []byte{0x04}),
+	}
+}
+
+// testPaths are the paths of testTLVs in depth-first order.
+var testPaths = []string{
+	"6F", "6F.84", "6F.A5", "6F.A5.BF0C",
+	"6F.A5.BF0C.61", "6F.A5.BF0C.61.4F", "6F.A5.BF0C.61.50",
+	"6F.A5.BF0C.61", "6F.A5.BF0C.61.4F", "6F.A5.BF0C.61.50",
+	"70", "70.57", "70", "70.57", "70.77", "70.77.9F10", "9F10",
+}
+
+func TestWalk(t *testing.T) {
+	var paths []string
+	var depths []int
+
+	bertlv.Walk(testTLVs(), func(path []string, tlv *bertlv.TLV) bertlv.WalkAction {
+		require.Equal(t, tlv.Tag, path[len(path)-1])
+
+		paths = append(paths, strings.Join(path, "."))
+		depths = append(depths, len(path))
+
+		return bertlv.WalkContinue
+	})
+
+	require.Equal(t, testPaths, paths)
+	require.Equal(t, []int{1, 2, 2, 3, 4, 5, 5, 4, 5, 5, 1, 2, 1, 2, 2, 3, 1}, depths)
+}
+
+func TestWalkSkipAndStop(t *testing.T) {
+	var visited []string
+
+	bertlv.Walk(testTLVs(), func(path []string, tlv *bertlv.TLV) bertlv.WalkAction {
+		visited = append(visited, tlv.Tag)
+
+		switch tlv.Tag {
+		case "A5":
+			return bertlv.WalkSkip
+		case "9F10":
+			return bertlv.WalkStop
+		}
+
+		return bertlv.WalkContinue
+	})
+
+	require.Equal(t, []string{"6F", "84", "A5", "70", "57", "70", "57", "77", "9F10"}, visited)
+}
+
+func TestWalkEditInPlace(t *testing.T) {
+	tlvs := testTLVs()
+
+	// mask the track 2 data of every record
+	bertlv.Walk(tlvs, func(path []string, tlv *bertlv.TLV) bertlv.WalkAction {
+		if slices.Equal(path, []string{"70", "57"}) {
+			tlv.Value = []byte{0xFF}
+		}
+
+		return bertlv.WalkContinue
+	})
+
+	require.Equal(t, []byte{0xFF}, tlvs[1].TLVs[0].Value)
+	require.Equal(t, []byte{0xFF}, tlvs[2].TLVs[0].Value)
+}